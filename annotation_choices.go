@@ -0,0 +1,52 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// annotation_choices.go implements the annotation: [choices: a|b|c]
+//
+// The value of an option or an argument must be one of the choices:
+//
+//	--format=<f>  Output format [choices: json|yaml|text] [default: text]
+//
+package main
+
+import (
+	"fmt"
+	"github.com/docopt/docopt-go"
+	"strings"
+)
+
+func init() {
+	Register_annotation("choices", &Annotation_handler{
+		Phase:     Phase_check,
+		Has_value: true,
+		Compile: func(e *Annotated_element, value string) error {
+			choices := Split_choices(value)
+			for _, c := range choices {
+				if c == "" {
+					return fmt.Errorf("empty choice in: %s", value)
+				}
+			}
+			if e.Option != nil && e.Option.Has_default && !string_set(choices)[e.Option.Default] {
+				return fmt.Errorf("default is not one of the choices: %s", e.Option.Default)
+			}
+			return element_has_value(e)
+		},
+		Apply: func(e *Annotated_element, value string, args docopt.Opts) error {
+			choices := Split_choices(value)
+			for _, v := range Element_values(args[e.Key]) {
+				if !string_set(choices)[v] {
+					return fmt.Errorf("%s: invalid choice: '%s', choose from: %s", e.Key, v, strings.Join(choices, ", "))
+				}
+			}
+			return nil
+		},
+	})
+}
+
+// Split_choices returns the choices written: a|b|c
+func Split_choices(value string) []string {
+	choices := strings.Split(value, "|")
+	for i := range choices {
+		choices[i] = strings.TrimSpace(choices[i])
+	}
+	return choices
+}
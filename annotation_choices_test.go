@@ -0,0 +1,51 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// unit test for annotation_choices.go
+//
+package main
+
+import (
+	"github.com/docopt/docopt-go"
+	"testing"
+)
+
+func TestAnnotation_choices(t *testing.T) {
+	doc := `Usage: prog [--format=<f>] [<shell>...]
+
+Options:
+  --format=<f>  Output format [choices: json | yaml|text] [default: text]
+  <shell>       [choices: bash|zsh]`
+	tables := []struct {
+		args       docopt.Opts
+		expect_err string
+	}{
+		{docopt.Opts{"--format": "yaml", "<shell>": []string{"bash", "zsh"}}, ""},
+		{docopt.Opts{"--format": nil, "<shell>": []string{}}, ""},
+		{docopt.Opts{"--format": "xml", "<shell>": []string{}}, "--format: invalid choice: 'xml', choose from: json, yaml, text"},
+		{docopt.Opts{"--format": "json", "<shell>": []string{"bash", "fish"}}, "<shell>: invalid choice: 'fish', choose from: bash, zsh"},
+	}
+	a, err := Parse_annotations(doc)
+	if err != nil {
+		t.Fatalf("Parse_annotations: %v", err)
+	}
+	for _, table := range tables {
+		err := a.Apply(table.args)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != table.expect_err {
+			t.Errorf("Apply(%v): got error %q, want %q", table.args, got, table.expect_err)
+		}
+	}
+
+	for _, bad := range []string{
+		"Usage: prog [-v]\n\nOptions:\n  -v  [choices: a|b]",
+		"Usage: prog [-f=<f>]\n\nOptions:\n  -f=<f>  [choices: a||b]",
+		"Usage: prog [-f=<f>]\n\nOptions:\n  -f=<f>  [choices: a|b] [default: c]",
+	} {
+		if _, err := Parse_annotations(bad); err == nil {
+			t.Errorf("Parse_annotations(%q): no error", bad)
+		}
+	}
+}
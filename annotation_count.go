@@ -0,0 +1,114 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// annotation_count.go implements the annotations: [min: N], [max: N] and
+// [unique]
+//
+// They constrain how many times a repeatable element is given, and if a value
+// can be given more than once:
+//
+//	<host>     Hosts to deploy [min: 2] [max: 5] [unique]
+//	-v         Verbosity [max: 3]
+//
+// An optional element not given is not checked by [min: N].
+//
+package main
+
+import (
+	"fmt"
+	"github.com/docopt/docopt-go"
+	"strconv"
+)
+
+func init() {
+	Register_annotation("min", &Annotation_handler{
+		Phase:     Phase_check,
+		Has_value: true,
+		Compile:   compile_count,
+		Apply: func(e *Annotated_element, value string, args docopt.Opts) error {
+			min, _ := strconv.Atoi(value)
+			if count := Element_count(args[e.Key]); count > 0 && count < min {
+				return fmt.Errorf("%s given %s, at least %d required", e.Key, times(count), min)
+			}
+			return nil
+		},
+	})
+	Register_annotation("max", &Annotation_handler{
+		Phase:     Phase_check,
+		Has_value: true,
+		Compile: func(e *Annotated_element, value string) error {
+			if err := compile_count(e, value); err != nil {
+				return err
+			}
+			min, found := e.Get("min")
+			if !found {
+				return nil
+			}
+			n_min, _ := strconv.Atoi(min)
+			if n_max, _ := strconv.Atoi(value); n_max < n_min {
+				return fmt.Errorf("max is less than min: %s < %s", value, min)
+			}
+			return nil
+		},
+		Apply: func(e *Annotated_element, value string, args docopt.Opts) error {
+			max, _ := strconv.Atoi(value)
+			if count := Element_count(args[e.Key]); count > max {
+				return fmt.Errorf("%s given %s, at most %d allowed", e.Key, times(count), max)
+			}
+			return nil
+		},
+	})
+	Register_annotation("unique", &Annotation_handler{
+		Phase: Phase_check,
+		Compile: func(e *Annotated_element, value string) error {
+			if !e.Repeated {
+				return fmt.Errorf("only for a repeatable element")
+			}
+			return element_has_value(e)
+		},
+		Apply: func(e *Annotated_element, value string, args docopt.Opts) error {
+			seen := make(map[string]bool)
+			for _, v := range Element_values(args[e.Key]) {
+				if seen[v] {
+					return fmt.Errorf("%s: '%s' given more than once", e.Key, v)
+				}
+				seen[v] = true
+			}
+			return nil
+		},
+	})
+}
+
+func compile_count(e *Annotated_element, value string) error {
+	if !e.Repeated {
+		return fmt.Errorf("only for a repeatable element")
+	}
+	if n, err := strconv.Atoi(value); err != nil || n < 0 {
+		return fmt.Errorf("not a count: %s", value)
+	}
+	return nil
+}
+
+// Element_count returns how many times an element is given: the length of an
+// array, a counter, or 1 for a given value.
+func Element_count(value interface{}) int {
+	switch v := value.(type) {
+	case []string:
+		return len(v)
+	case int:
+		return v
+	case bool:
+		if v {
+			return 1
+		}
+	case string:
+		return 1
+	}
+	return 0
+}
+
+func times(count int) string {
+	if count == 1 {
+		return "1 time"
+	}
+	return fmt.Sprintf("%d times", count)
+}
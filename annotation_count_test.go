@@ -0,0 +1,75 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// unit test for annotation_count.go
+//
+package main
+
+import (
+	"github.com/docopt/docopt-go"
+	"testing"
+)
+
+func TestAnnotation_count(t *testing.T) {
+	doc := `Usage: prog [-v...] [--tag=<t>...] <host>...
+
+Options:
+  -v         Verbosity [max: 3]
+  --tag=<t>  Tags [min: 2] [unique]
+  <host>     Hosts [max: 5]`
+	tables := []struct {
+		args       docopt.Opts
+		expect_err string
+	}{
+		{docopt.Opts{"-v": 3, "--tag": []string{"a", "b"}, "<host>": []string{"h1"}}, ""},
+		{docopt.Opts{"-v": 0, "--tag": []string{}, "<host>": []string{"h1", "h2", "h3", "h4", "h5"}}, ""},
+		{docopt.Opts{"-v": 4, "--tag": []string{}, "<host>": []string{"h1"}}, "-v given 4 times, at most 3 allowed"},
+		{docopt.Opts{"-v": 0, "--tag": []string{"a"}, "<host>": []string{"h1"}}, "--tag given 1 time, at least 2 required"},
+		{docopt.Opts{"-v": 0, "--tag": []string{"a", "b", "a"}, "<host>": []string{"h1"}}, "--tag: 'a' given more than once"},
+		{docopt.Opts{"-v": 0, "--tag": []string{}, "<host>": []string{"1", "2", "3", "4", "5", "6", "7"}}, "<host> given 7 times, at most 5 allowed"},
+	}
+	a, err := Parse_annotations(doc)
+	if err != nil {
+		t.Fatalf("Parse_annotations: %v", err)
+	}
+	for _, table := range tables {
+		err := a.Apply(table.args)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != table.expect_err {
+			t.Errorf("Apply(%v): got error %q, want %q", table.args, got, table.expect_err)
+		}
+	}
+
+	for _, bad := range []string{
+		"Usage: prog <f>\n\nOptions:\n  <f>  [max: 2]",
+		"Usage: prog [-v]\n\nOptions:\n  -v  [min: 1]",
+		"Usage: prog <f>...\n\nOptions:\n  <f>  [max: two]",
+		"Usage: prog <f>...\n\nOptions:\n  <f>  [min: 3] [max: 2]",
+		"Usage: prog [-v...]\n\nOptions:\n  -v  [unique]",
+	} {
+		if _, err := Parse_annotations(bad); err == nil {
+			t.Errorf("Parse_annotations(%q): no error", bad)
+		}
+	}
+}
+
+func TestElement_count(t *testing.T) {
+	tables := []struct {
+		value  interface{}
+		expect int
+	}{
+		{[]string{"a", "b"}, 2},
+		{3, 3},
+		{true, 1},
+		{false, 0},
+		{"a", 1},
+		{nil, 0},
+	}
+	for _, table := range tables {
+		if got := Element_count(table.value); got != table.expect {
+			t.Errorf("Element_count(%v): got %d, want %d", table.value, got, table.expect)
+		}
+	}
+}
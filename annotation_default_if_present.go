@@ -0,0 +1,154 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// annotation_default_if_present.go implements the options with an optional
+// value: --name[=<arg>] and the annotation [default-if-present: value]
+//
+//	Usage: prog [--color[=<when>]] [<file>]
+//
+//	Options:
+//	  --color[=<when>]  Colorize [default-if-present: auto] [default: never]
+//
+// docopt is given --color=<when>, and argv is rewritten by Prepare_argv():
+// --color alone is given as --color=auto, so in --color foo, foo is an
+// argument. The value is the one given, the default if present, or as any
+// option if --color is not given: its default or nil.
+//
+// A short alias, -c, --color[=<when>], takes its value attached: -c alone is
+// given as -cauto, -cfoo gives foo and in -c foo, foo is an argument.
+//
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var re_optional_value = regexp.MustCompile(`(--[A-Za-z0-9][A-Za-z0-9_-]*)\[=(<[^>]+>|[A-Z][A-Z0-9_-]*)\]`)
+
+func init() {
+	Register_syntax("optional-value")
+	Register_annotation("default-if-present", &Annotation_handler{
+		// see Prepare_argv()
+		Phase:     Phase_fill,
+		Has_value: true,
+		Compile: func(e *Annotated_element, value string) error {
+			if e.Option == nil || e.Option.Long == "" || e.Option.Argcount == 0 {
+				return fmt.Errorf("only for a long option with an argument")
+			}
+			return nil
+		},
+	})
+}
+
+// rewrite_optional_values rewrites --name[=<arg>] as --name=<arg> in the
+// lines given to docopt. It returns the first line of the entries of the
+// options with an optional value.
+func (a *Annotated_usage) rewrite_optional_values() map[int]bool {
+	entries := make(map[int]bool)
+	for _, entry := range a.entries {
+		for _, option := range entry_options(a.lines, entry) {
+			if re_optional_value.MatchString(option) {
+				entries[entry[0]] = true
+			}
+		}
+	}
+	for i, line := range a.lines {
+		a.lines[i] = re_optional_value.ReplaceAllString(line, "$1=$2")
+	}
+	return entries
+}
+
+// Prepare_argv returns argv to give to docopt: the options annotated
+// [default-if-present: value] given without value are given the value. argv
+// is kept in a.Argv. With options_first, options are only searched before
+// the first argument, as docopt does.
+func (a *Annotated_usage) Prepare_argv(argv []string, options_first bool) []string {
+	if argv == nil {
+		argv = []string{}
+	}
+	a.Argv = argv
+	a.options_first = options_first
+	present := a.optional_values()
+	if len(present) == 0 || a.model == nil {
+		return argv
+	}
+
+	prepared := make([]string, len(argv))
+	copy(prepared, argv)
+	a.scan_options(argv, func(i int, key string, attached bool) {
+		value, found := present[key]
+		switch {
+		case !found || attached:
+		case strings.HasPrefix(argv[i], "--"):
+			prepared[i] = key + "=" + value
+		default:
+			// a short option taking a value is the last of argv[i]
+			prepared[i] = argv[i] + value
+		}
+	})
+	return prepared
+}
+
+// optional_values returns the value of [default-if-present: value] of the
+// options with an optional value.
+func (a *Annotated_usage) optional_values() map[string]string {
+	present := make(map[string]string)
+	for _, e := range a.Elements {
+		if value, found := e.Get("default-if-present"); found {
+			present[e.Key] = value
+		}
+	}
+	return present
+}
+
+// scan_options calls found for each option of argv, as docopt reads it, with
+// its index and its key: abbreviated long options are expanded, a short
+// option is named by its long option. attached tells if an option is given
+// with its value: --name=value or -nvalue. The value of an option is skipped,
+// it is not an option, and the options end at --, or at the first argument
+// with options_first.
+func (a *Annotated_usage) scan_options(argv []string, found func(i int, key string, attached bool)) {
+	if a.model == nil {
+		return
+	}
+	present := a.optional_values()
+	key_of := func(name string) (string, *Option_desc) {
+		if o := a.model.Find_option(name); o != nil {
+			return o.Name(), o
+		}
+		return name, nil
+	}
+	for i := 0; i < len(argv); i++ {
+		arg := argv[i]
+		switch {
+		case arg == "--":
+			return
+		case strings.HasPrefix(arg, "--"):
+			name, eq, _ := string_partition(arg, "=")
+			key, o := key_of(a.long_option(name))
+			found(i, key, eq != "")
+			if _, optional := present[key]; o != nil && o.Argcount > 0 && eq == "" && !optional {
+				// its value is the next argument
+				i++
+			}
+		case strings.HasPrefix(arg, "-") && arg != "-":
+			for j := 1; j < len(arg); j++ {
+				key, o := key_of("-" + arg[j:j+1])
+				takes_value := o != nil && o.Argcount > 0
+				found(i, key, takes_value && j < len(arg)-1)
+				if takes_value {
+					// the value is the rest of arg, or the next argument
+					if _, optional := present[key]; j == len(arg)-1 && !optional {
+						i++
+					}
+					break
+				}
+			}
+		default:
+			if a.options_first {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,112 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// unit test for annotation_default_if_present.go
+//
+package main
+
+import (
+	"github.com/docopt/docopts/docopt_engine"
+	"reflect"
+	"testing"
+)
+
+func TestPrepare_argv(t *testing.T) {
+	doc := `Usage: prog [--color[=<when>]] [-o <out>] [-v] [-x <x>] [--name <n>] [<file>...]
+
+Options:
+  --color[=<when>]  Colorize [default-if-present: auto]
+  -o <out>          Output
+  -x <x>            X
+  --name <n>        Name`
+	tables := []struct {
+		argv          []string
+		options_first bool
+		expect        []string
+	}{
+		{[]string{}, false, []string{}},
+		{[]string{"--color", "foo"}, false, []string{"--color=auto", "foo"}},
+		{[]string{"--col", "--color=always"}, false, []string{"--color=auto", "--color=always"}},
+		// values of options are not options
+		{[]string{"-o", "--color", "--name", "--color", "-vx", "--color", "-x--color"}, false,
+			[]string{"-o", "--color", "--name", "--color", "-vx", "--color", "-x--color"}},
+		{[]string{"foo", "--color", "--", "--color"}, false, []string{"foo", "--color=auto", "--", "--color"}},
+		{[]string{"foo", "--color"}, true, []string{"foo", "--color"}},
+	}
+	a, err := Parse_annotations(doc)
+	if err != nil {
+		t.Fatalf("Parse_annotations: %v", err)
+	}
+	expect_doc := "Usage: prog [--color=<when>] [-o <out>] [-v] [-x <x>] [--name <n>] [<file>...]"
+	if a.Doc[:len(expect_doc)] != expect_doc {
+		t.Errorf("Parse_annotations(): got Doc %q", a.Doc)
+	}
+	for _, table := range tables {
+		argv := append([]string{}, table.argv...)
+		got := a.Prepare_argv(argv, table.options_first)
+		if !reflect.DeepEqual(got, table.expect) {
+			t.Errorf("Prepare_argv(%q, %v): got %q, want %q", table.argv, table.options_first, got, table.expect)
+		}
+		if !reflect.DeepEqual(a.Argv, table.argv) {
+			t.Errorf("Prepare_argv(%q, %v): argv modified: %q", table.argv, table.options_first, a.Argv)
+		}
+	}
+
+	for _, bad := range []string{
+		"Usage: prog [options]\n\nOptions:\n  --color[=<when>]  Color",
+		"Usage: prog [options]\n\nOptions:\n  --color  Color [default-if-present: auto]",
+		"Usage: prog [options]\n\nOptions:\n  -c <when>  Color [default-if-present: auto]",
+	} {
+		if _, err := Parse_annotations(bad); err == nil {
+			t.Errorf("Parse_annotations(%q): no error", bad)
+		}
+	}
+}
+
+func TestDefault_if_present_usage_error(t *testing.T) {
+	a, err := Parse_annotations("Usage: prog [--color[=<when>]]\n\nOptions:\n  --color[=<when>]  Colorize [default-if-present: auto]\n")
+	if err != nil {
+		t.Fatalf("Parse_annotations: %v", err)
+	}
+	var got error
+	usage := ""
+	parser := &docopt_engine.Parser{HelpHandler: a.Help_handler(func(err error, u string) { got, usage = err, u })}
+	parser.ParseDoc(a.Doc, a.Prepare_argv([]string{"extra"}, false), "")
+	if got == nil || usage != "Usage: prog [--color[=<when>]]" {
+		t.Errorf("usage error: got %v %q, want the usage as written", got, usage)
+	}
+}
+
+func TestDefault_if_present_short_alias(t *testing.T) {
+	a, err := Parse_annotations(`Usage: prog [options] [<file>]
+
+Options:
+  -v                Verbose
+  -w, --when[=<w>]  When [default-if-present: auto]`)
+	if err != nil {
+		t.Fatalf("Parse_annotations: %v", err)
+	}
+	tables := []struct {
+		argv []string
+		when interface{}
+		file interface{}
+	}{
+		{[]string{"--when"}, "auto", nil},
+		{[]string{"--when", "foo"}, "auto", "foo"},
+		{[]string{"--when=foo"}, "foo", nil},
+		{[]string{"-w", "foo"}, "auto", "foo"},
+		{[]string{"-vw"}, "auto", nil},
+		{[]string{"-wfoo"}, "foo", nil},
+		{[]string{"foo"}, nil, "foo"},
+	}
+	parser := &docopt_engine.Parser{}
+	for _, table := range tables {
+		args, err := parser.ParseDoc(a.Doc, a.Prepare_argv(table.argv, false), "")
+		if err != nil {
+			t.Errorf("ParseDoc(%q): %v", table.argv, err)
+			continue
+		}
+		if args["--when"] != table.when || args["<file>"] != table.file {
+			t.Errorf("ParseDoc(%q): got --when=%v <file>=%v, want %v %v", table.argv, args["--when"], args["<file>"], table.when, table.file)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// annotation_deprecated.go implements the annotations to rename options
+// without breaking callers: [hidden], [deprecated: message] and
+// [alias-of: --option]
+//
+//	--new-name=<n>  The new name
+//	--old-name=<n>  [hidden] [deprecated: use --new-name] [alias-of: --new-name]
+//
+// [hidden] removes the description from --help, [deprecated: ] outputs a
+// warning on stderr when the option is given, and the value of an alias is
+// moved to the option it is an alias of: no variable is output for the alias.
+//
+package main
+
+import (
+	"fmt"
+	"github.com/docopt/docopt-go"
+)
+
+func init() {
+	Register_annotation("hidden", &Annotation_handler{
+		// see Parse_annotations()
+		Phase: Phase_check,
+	})
+	Register_annotation("deprecated", &Annotation_handler{
+		Phase:     Phase_check,
+		Has_value: true,
+		Warn: func(e *Annotated_element, value string) string {
+			return fmt.Sprintf("warning: %s is deprecated: %s", e.Key, value)
+		},
+	})
+	Register_annotation("alias-of", &Annotation_handler{
+		Phase:     Phase_transform,
+		Has_value: true,
+		Compile: func(e *Annotated_element, value string) error {
+			if e.Option == nil {
+				return fmt.Errorf("only for an option")
+			}
+			m := e.usage.model
+			if m == nil {
+				return nil
+			}
+			target := m.Find_option(value)
+			if target == nil || !string_set(m.Leaves())[target.Name()] {
+				return fmt.Errorf("%s not found in usage", value)
+			}
+			if target.Name() == e.Key {
+				return fmt.Errorf("alias of itself")
+			}
+			if target.Argcount != e.Option.Argcount {
+				return fmt.Errorf("%s and %s don't both take an argument", e.Key, value)
+			}
+			return nil
+		},
+		Apply: func(e *Annotated_element, value string, args docopt.Opts) error {
+			a := e.usage
+			target := value
+			if a.model != nil {
+				target = a.model.Find_option(value).Name()
+			}
+			given := a.is_given(e.Key, args)
+			alias_value := args[e.Key]
+			delete(args, e.Key)
+			if !given {
+				return nil
+			}
+			// a value filled by another source than argv is replaced
+			source, filled := a.sources[target]
+			if (!filled || source == "argv") && a.is_given(target, args) {
+				return fmt.Errorf("%s is an alias of %s, give only one", e.Key, target)
+			}
+			args[target] = alias_value
+			if filled {
+				a.sources[target] = "argv"
+			}
+			return nil
+		},
+	})
+}
@@ -0,0 +1,102 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// unit test for annotation_deprecated.go
+//
+package main
+
+import (
+	"github.com/docopt/docopt-go"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestAnnotation_hidden(t *testing.T) {
+	doc := `Usage: prog [options]
+
+Options: --old  [hidden]
+  --new=<n>     The new name
+  --other=<n>   [hidden] Described on
+                two lines
+  -v            Verbose`
+	a, err := Parse_annotations(doc)
+	if err != nil {
+		t.Fatalf("Parse_annotations: %v", err)
+	}
+	expect := `Usage: prog [options]
+
+Options:
+  --new=<n>     The new name
+  -v            Verbose`
+	if a.Help != expect {
+		t.Errorf("Parse_annotations(): got Help %q, want %q", a.Help, expect)
+	}
+}
+
+func TestAnnotation_deprecated(t *testing.T) {
+	doc := `Usage: prog [options]
+
+Options:
+  --new-name=<n>  The new name [env: TEST_DOCOPTS_NEW_NAME]
+  --old-name=<n>  [deprecated: use --new-name] [alias-of: --new-name]
+  -o <n>          [alias-of: --new-name]
+  -q              [deprecated: use -v] [alias-of: -v]
+  -v, --verbose   Verbose`
+	tables := []struct {
+		env             string
+		args            docopt.Opts
+		expect          docopt.Opts
+		expect_warnings []string
+		expect_err      string
+	}{
+		{"", docopt.Opts{"--new-name": nil, "--old-name": "x", "-o": nil, "-q": false, "--verbose": false},
+			docopt.Opts{"--new-name": "x", "--verbose": false},
+			[]string{"warning: --old-name is deprecated: use --new-name"}, ""},
+		{"", docopt.Opts{"--new-name": "y", "--old-name": nil, "-o": nil, "-q": true, "--verbose": false},
+			docopt.Opts{"--new-name": "y", "--verbose": true},
+			[]string{"warning: -q is deprecated: use -v"}, ""},
+		// a value from the environment is replaced
+		{"z", docopt.Opts{"--new-name": nil, "--old-name": nil, "-o": "x", "-q": false, "--verbose": false},
+			docopt.Opts{"--new-name": "x", "--verbose": false}, []string{}, ""},
+		{"", docopt.Opts{"--new-name": "y", "--old-name": "x", "-o": nil, "-q": false, "--verbose": false},
+			nil, nil, "--old-name is an alias of --new-name, give only one"},
+	}
+	for _, table := range tables {
+		os.Setenv("TEST_DOCOPTS_NEW_NAME", table.env)
+		a, err := Parse_annotations(doc)
+		if err != nil {
+			t.Fatalf("Parse_annotations: %v", err)
+		}
+		err = a.Apply(table.args)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != table.expect_err {
+			t.Errorf("Apply(): got error %q, want %q", got, table.expect_err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if !reflect.DeepEqual(table.args, table.expect) {
+			t.Errorf("Apply(): got %v, want %v", table.args, table.expect)
+		}
+		if !reflect.DeepEqual(a.Warnings, table.expect_warnings) {
+			t.Errorf("Apply(): got warnings %q, want %q", a.Warnings, table.expect_warnings)
+		}
+	}
+	os.Unsetenv("TEST_DOCOPTS_NEW_NAME")
+
+	for _, bad := range []string{
+		"Usage: prog [options]\n\nOptions:\n  --old  [alias-of: --new]",
+		"Usage: prog [options]\n\nOptions:\n  --old  [alias-of: --old]",
+		"Usage: prog [options]\n\nOptions:\n  --new=<n>  New\n  --old  [alias-of: --new]",
+		"Usage: prog <old>\n\nOptions:\n  <old>  [alias-of: --new]",
+		"Usage: prog [options]\n\nOptions:\n  --old  [deprecated]",
+	} {
+		if _, err := Parse_annotations(bad); err == nil {
+			t.Errorf("Parse_annotations(%q): no error", bad)
+		}
+	}
+}
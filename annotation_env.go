@@ -0,0 +1,80 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// annotation_env.go implements the annotation: [env: NAME]
+//
+// An option or an argument not given on argv is filled from the environment
+// variable NAME, before its default: argv > env > default.
+//
+//	--token=<t>  API token [env: MYTOOL_TOKEN]
+//
+package main
+
+import (
+	"fmt"
+	"github.com/docopt/docopt-go"
+	"os"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	Register_annotation("env", &Annotation_handler{
+		Phase:     Phase_fill,
+		Has_value: true,
+		Fill:      true,
+		Compile: func(e *Annotated_element, value string) error {
+			if !IsBashIdentifier(value) {
+				return fmt.Errorf("not a valid environment variable name: '%s'", value)
+			}
+			return nil
+		},
+		Apply: func(e *Annotated_element, value string, args docopt.Opts) error {
+			env, found := e.usage.lookup_env(value)
+			if !found || env == "" {
+				return nil
+			}
+			filled, err := Fill_value(args[e.Key], env)
+			if err != nil {
+				return fmt.Errorf("%s: invalid value in $%s: '%s'", e.Key, value, env)
+			}
+			args[e.Key] = filled
+			return nil
+		},
+	})
+}
+
+// lookup_env returns the variable name of a.Env, or of the environment if
+// a.Env is nil: a server reads the environment of its client.
+func (a *Annotated_usage) lookup_env(name string) (string, bool) {
+	if a.Env == nil {
+		return os.LookupEnv(name)
+	}
+	value, found := a.Env[name]
+	return value, found
+}
+
+// Environ_map returns the variables of environ, as returned by os.Environ(),
+// by name.
+func Environ_map(environ []string) map[string]string {
+	env := make(map[string]string, len(environ))
+	for _, kv := range environ {
+		if name, eq, value := string_partition(kv, "="); eq != "" {
+			env[name] = value
+		}
+	}
+	return env
+}
+
+// Fill_value converts s to the type of the missing value: words for an
+// array, a bool for a flag, a counter, else the string.
+func Fill_value(missing interface{}, s string) (interface{}, error) {
+	switch missing.(type) {
+	case []string:
+		return strings.Fields(s), nil
+	case bool:
+		return Parse_bool(s)
+	case int:
+		return strconv.Atoi(s)
+	}
+	return s, nil
+}
@@ -0,0 +1,84 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// unit test for annotation_env.go
+//
+package main
+
+import (
+	"github.com/docopt/docopt-go"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestAnnotation_env(t *testing.T) {
+	doc := `Usage: prog [-v] [--token=<t>] [--tag=<tag>...] [<host>]
+
+Options:
+  -v            Verbose [env: TEST_DOCOPTS_VERBOSE]
+  --token=<t>   API token [default: none] [env: TEST_DOCOPTS_TOKEN]
+  --tag=<tag>   Tags [env: TEST_DOCOPTS_TAGS] [default: a b]
+  <host>        [env: TEST_DOCOPTS_HOST]`
+	tables := []struct {
+		env            map[string]string
+		args           docopt.Opts
+		expect         docopt.Opts
+		expect_sources map[string]string
+		expect_err     bool
+	}{
+		{
+			map[string]string{},
+			docopt.Opts{"-v": false, "--token": nil, "--tag": []string{}, "<host>": nil},
+			docopt.Opts{"-v": false, "--token": "none", "--tag": []string{"a", "b"}, "<host>": nil},
+			map[string]string{"-v": "not given", "--token": "default", "--tag": "default", "<host>": "not given"},
+			false,
+		},
+		{
+			map[string]string{"TEST_DOCOPTS_VERBOSE": "yes", "TEST_DOCOPTS_TOKEN": "secret", "TEST_DOCOPTS_TAGS": "x y", "TEST_DOCOPTS_HOST": "h"},
+			docopt.Opts{"-v": false, "--token": nil, "--tag": []string{}, "<host>": nil},
+			docopt.Opts{"-v": true, "--token": "secret", "--tag": []string{"x", "y"}, "<host>": "h"},
+			map[string]string{"-v": "[env: TEST_DOCOPTS_VERBOSE]", "--token": "[env: TEST_DOCOPTS_TOKEN]",
+				"--tag": "[env: TEST_DOCOPTS_TAGS]", "<host>": "[env: TEST_DOCOPTS_HOST]"},
+			false,
+		},
+		{
+			// argv > env, even if the value given is the default
+			map[string]string{"TEST_DOCOPTS_TOKEN": "secret"},
+			docopt.Opts{"-v": true, "--token": "none", "--tag": []string{"z"}, "<host>": "h"},
+			docopt.Opts{"-v": true, "--token": "none", "--tag": []string{"z"}, "<host>": "h"},
+			map[string]string{"-v": "argv", "--token": "argv", "--tag": "argv", "<host>": "argv"},
+			false,
+		},
+		{
+			map[string]string{"TEST_DOCOPTS_VERBOSE": "maybe"},
+			docopt.Opts{"-v": false, "--token": nil, "--tag": []string{}, "<host>": nil},
+			nil, nil, true,
+		},
+	}
+	for _, table := range tables {
+		for _, name := range []string{"TEST_DOCOPTS_VERBOSE", "TEST_DOCOPTS_TOKEN", "TEST_DOCOPTS_TAGS", "TEST_DOCOPTS_HOST"} {
+			os.Unsetenv(name)
+		}
+		for name, value := range table.env {
+			os.Setenv(name, value)
+		}
+		a, err := Parse_annotations(doc)
+		if err != nil {
+			t.Fatalf("Parse_annotations: %v", err)
+		}
+		err = a.Apply(table.args)
+		if (err != nil) != table.expect_err {
+			t.Errorf("Apply(%v) env %v: got error %v, want error: %v", table.args, table.env, err, table.expect_err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if !reflect.DeepEqual(table.args, table.expect) {
+			t.Errorf("Apply() env %v: got %v, want %v", table.env, table.args, table.expect)
+		}
+		if sources := a.Sources(); !reflect.DeepEqual(sources, table.expect_sources) {
+			t.Errorf("Sources() env %v: got %v, want %v", table.env, sources, table.expect_sources)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// annotation_map.go implements the annotation: [map]
+//
+// The values of an option or an argument are key=value pairs, output as an
+// associative array:
+//
+//	--set=<kv>  Settings [map]         --set a=1 --set b=2
+//
+//	global mode:  declare -A set=(['a']='1' ['b']='2')
+//	-A args:      args['--set:a']='1'
+//	              args['--set:b']='2'
+//
+// A key given again replaces its value.
+//
+package main
+
+import (
+	"fmt"
+	"github.com/docopt/docopt-go"
+	"strings"
+)
+
+func init() {
+	Register_annotation("map", &Annotation_handler{
+		Phase: Phase_transform,
+		Compile: func(e *Annotated_element, value string) error {
+			return element_has_value(e)
+		},
+		Apply: func(e *Annotated_element, value string, args docopt.Opts) error {
+			m := make(map[string]string)
+			for _, v := range Element_values(args[e.Key]) {
+				key, eq, kv_value := string_partition(v, "=")
+				if eq == "" || key == "" {
+					return fmt.Errorf("%s: key=value expected: '%s'", e.Key, v)
+				}
+				m[key] = kv_value
+			}
+			args[e.Key] = m
+			return nil
+		},
+	})
+}
+
+// Map_items returns the key=value items of m, sorted by key.
+func Map_items(m map[string]string) []string {
+	items := []string{}
+	for _, key := range sorted_names(m) {
+		items = append(items, key+"="+m[key])
+	}
+	return items
+}
+
+// map_to_bash returns the bash associative array of m, keys sorted.
+func map_to_bash(m map[string]string) string {
+	items := []string{}
+	for _, key := range sorted_names(m) {
+		items = append(items, fmt.Sprintf("['%s']='%s'", Shellquote(key), Shellquote(m[key])))
+	}
+	return "(" + strings.Join(items, " ") + ")"
+}
@@ -0,0 +1,81 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// unit test for annotation_map.go
+//
+package main
+
+import (
+	"bytes"
+	"github.com/docopt/docopt-go"
+	"reflect"
+	"testing"
+)
+
+func TestAnnotation_map(t *testing.T) {
+	doc := `Usage: prog [--set=<kv>...] [<env>]
+
+Options:
+  --set=<kv>  Settings [map]
+  <env>       Environment [map]`
+	tables := []struct {
+		args       docopt.Opts
+		expect     docopt.Opts
+		expect_err string
+	}{
+		{docopt.Opts{"--set": []string{"a=1", "b=x=y", "a=3", "c="}, "<env>": "k=v"},
+			docopt.Opts{"--set": map[string]string{"a": "3", "b": "x=y", "c": ""}, "<env>": map[string]string{"k": "v"}}, ""},
+		{docopt.Opts{"--set": []string{}, "<env>": nil},
+			docopt.Opts{"--set": map[string]string{}, "<env>": map[string]string{}}, ""},
+		{docopt.Opts{"--set": []string{"a=1", "b"}, "<env>": nil}, nil, "--set: key=value expected: 'b'"},
+		{docopt.Opts{"--set": []string{"=1"}, "<env>": nil}, nil, "--set: key=value expected: '=1'"},
+	}
+	a, err := Parse_annotations(doc)
+	if err != nil {
+		t.Fatalf("Parse_annotations: %v", err)
+	}
+	for _, table := range tables {
+		err := a.Apply(table.args)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != table.expect_err {
+			t.Errorf("Apply(): got error %q, want %q", got, table.expect_err)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(table.args, table.expect) {
+			t.Errorf("Apply(): got %v, want %v", table.args, table.expect)
+		}
+	}
+
+	if _, err := Parse_annotations("Usage: prog [-v]\n\nOptions:\n  -v  [map]"); err == nil {
+		t.Errorf("Parse_annotations([map] on a flag): no error")
+	}
+}
+
+func TestMap_output(t *testing.T) {
+	args := docopt.Opts{"--set": map[string]string{"b": "it's", "a": "1"}}
+	var buf bytes.Buffer
+	d := &Docopts{Mangle_key: true, Output: &buf}
+
+	d.Print_bash_args("args", args)
+	expect := "args['--set:a']='1'\nargs['--set:b']='it'\\''s'\n"
+	if buf.String() != expect {
+		t.Errorf("Print_bash_args(): got %q, want %q", buf.String(), expect)
+	}
+
+	buf.Reset()
+	d.Print_bash_global(args)
+	expect = "declare -gA set=(['a']='1' ['b']='it'\\''s')\n"
+	if buf.String() != expect {
+		t.Errorf("Print_bash_global(): got %q, want %q", buf.String(), expect)
+	}
+
+	env, err := d.Environment(args, "", "", false)
+	if err != nil {
+		t.Fatalf("Environment(): %v", err)
+	}
+	if *env["set_COUNT"] != "2" || *env["set_0"] != "a=1" || *env["set_1"] != "b=it's" {
+		t.Errorf("Environment(): got %v", env)
+	}
+}
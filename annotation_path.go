@@ -0,0 +1,164 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// annotation_path.go implements the annotation: [path: flag,flag...]
+//
+// The value of an option or an argument is a path, checked according to the
+// flags, and optionally output normalized:
+//
+//	--output=<dir>  [path: dir,writable,absolute]
+//	FILENAME        [path: file,exists,stdin-ok]
+//
+package main
+
+import (
+	"fmt"
+	"github.com/docopt/docopt-go"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Path_flags are the flags of [path: ...]:
+//   - file, dir: if it exists, the path is a file, a directory;
+//   - exists: the path exists;
+//   - readable: the path exists and is readable;
+//   - writable: the path is writable, or can be created in its directory;
+//   - absolute: the path is output absolute and cleaned;
+//   - stdin-ok: - is accepted, output as /dev/stdin.
+var Path_flags = []string{"file", "dir", "exists", "readable", "writable", "absolute", "stdin-ok"}
+
+func init() {
+	Register_annotation("path", &Annotation_handler{
+		Phase:     Phase_check,
+		Has_value: true,
+		Compile: func(e *Annotated_element, value string) error {
+			flags, err := Split_path_flags(value)
+			if err != nil {
+				return err
+			}
+			if flags["file"] && flags["dir"] {
+				return fmt.Errorf("file and dir are exclusive")
+			}
+			return element_has_value(e)
+		},
+		Apply: func(e *Annotated_element, value string, args docopt.Opts) error {
+			flags, _ := Split_path_flags(value)
+			switch v := args[e.Key].(type) {
+			case string:
+				path, err := Check_path(v, flags, e.usage.Dir)
+				if err != nil {
+					return fmt.Errorf("%s: %v", e.Key, err)
+				}
+				args[e.Key] = path
+			case []string:
+				for i, s := range v {
+					path, err := Check_path(s, flags, e.usage.Dir)
+					if err != nil {
+						return fmt.Errorf("%s: %v", e.Key, err)
+					}
+					v[i] = path
+				}
+			}
+			return nil
+		},
+	})
+}
+
+// Split_path_flags returns the set of flags written: file,exists
+func Split_path_flags(value string) (map[string]bool, error) {
+	flags := make(map[string]bool)
+	for _, f := range strings.Split(value, ",") {
+		f = strings.TrimSpace(f)
+		if !string_set(Path_flags)[f] {
+			return nil, fmt.Errorf("unknown path flag: '%s', flags are: %s", f, strings.Join(Path_flags, ", "))
+		}
+		flags[f] = true
+	}
+	return flags, nil
+}
+
+// Check_path checks path according to flags, and returns the path to output.
+// A relative path is relative to dir, or to the current directory if dir is
+// empty.
+func Check_path(path string, flags map[string]bool, dir string) (string, error) {
+	if path == "-" && flags["stdin-ok"] {
+		return "/dev/stdin", nil
+	}
+	if path == "" {
+		return "", fmt.Errorf("empty path")
+	}
+
+	given := path
+	path = join_dir(dir, path)
+	info, err := os.Stat(path)
+	switch {
+	case err == nil:
+		if flags["file"] && info.IsDir() {
+			return "", fmt.Errorf("not a file: '%s'", given)
+		}
+		if flags["dir"] && !info.IsDir() {
+			return "", fmt.Errorf("not a directory: '%s'", given)
+		}
+	case os.IsNotExist(err):
+		if flags["exists"] || flags["readable"] {
+			return "", fmt.Errorf("no such file or directory: '%s'", given)
+		}
+	default:
+		return "", fmt.Errorf("%v", err)
+	}
+
+	if flags["readable"] && !is_readable(path) {
+		return "", fmt.Errorf("not readable: '%s'", given)
+	}
+	if flags["writable"] && !is_writable(path, info) {
+		return "", fmt.Errorf("not writable: '%s'", given)
+	}
+
+	if flags["absolute"] {
+		return filepath.Abs(path)
+	}
+	return given, nil
+}
+
+// join_dir returns path relative to dir, path if dir is empty or path is
+// absolute.
+func join_dir(dir string, path string) string {
+	if dir == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+func is_readable(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	f.Close()
+	return true
+}
+
+// is_writable checks by opening the file, or by creating a temporary file
+// in the directory: permission bits don't tell about ACLs or read-only file
+// systems.
+func is_writable(path string, info os.FileInfo) bool {
+	dir := path
+	if info == nil {
+		dir = filepath.Dir(path)
+	} else if !info.IsDir() {
+		f, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			return false
+		}
+		f.Close()
+		return true
+	}
+	f, err := ioutil.TempFile(dir, ".docopts-")
+	if err != nil {
+		return false
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return true
+}
@@ -0,0 +1,113 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// unit test for annotation_path.go
+//
+package main
+
+import (
+	"github.com/docopt/docopt-go"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheck_path(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docopts-path-")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "file.txt")
+	ioutil.WriteFile(file, []byte("content"), 0644)
+	missing := filepath.Join(dir, "missing.txt")
+
+	tables := []struct {
+		path       string
+		flags      string
+		expect     string
+		expect_err bool
+	}{
+		{file, "file,exists", file, false},
+		{file, "dir", "", true},
+		{dir, "dir,writable", dir, false},
+		{dir, "file", "", true},
+		{missing, "file", missing, false},
+		{missing, "file,exists", "", true},
+		{missing, "readable", "", true},
+		{missing, "writable", missing, false},
+		{filepath.Join(missing, "sub"), "writable", "", true},
+		{file, "readable,writable", file, false},
+		{"-", "file,exists,stdin-ok", "/dev/stdin", false},
+		{"-", "file", "-", false},
+		{"", "file", "", true},
+		{dir + "/./file.txt", "absolute", file, false},
+	}
+	for _, table := range tables {
+		flags, err := Split_path_flags(table.flags)
+		if err != nil {
+			t.Fatalf("Split_path_flags(%q): %v", table.flags, err)
+		}
+		got, err := Check_path(table.path, flags, "")
+		if (err != nil) != table.expect_err {
+			t.Errorf("Check_path(%q, %s): got error %v, want error: %v", table.path, table.flags, err, table.expect_err)
+			continue
+		}
+		if got != table.expect {
+			t.Errorf("Check_path(%q, %s): got %q, want %q", table.path, table.flags, got, table.expect)
+		}
+	}
+
+	// relative paths are made absolute from the current directory
+	cwd, _ := os.Getwd()
+	got, err := Check_path("some/file", map[string]bool{"absolute": true}, "")
+	if err != nil || got != filepath.Join(cwd, "some/file") {
+		t.Errorf("Check_path(some/file, absolute): got %q, %v", got, err)
+	}
+
+	// or from the directory given, the path output is the one given
+	got, err = Check_path("file.txt", map[string]bool{"file": true, "exists": true}, dir)
+	if err != nil || got != "file.txt" {
+		t.Errorf("Check_path(file.txt, file,exists, %s): got %q, %v", dir, got, err)
+	}
+	got, err = Check_path("file.txt", map[string]bool{"absolute": true}, dir)
+	if err != nil || got != file {
+		t.Errorf("Check_path(file.txt, absolute, %s): got %q, %v", dir, got, err)
+	}
+	if _, err = Check_path("missing.txt", map[string]bool{"exists": true}, dir); err == nil {
+		t.Errorf("Check_path(missing.txt, exists, %s): expecting error", dir)
+	}
+}
+
+func TestAnnotation_path(t *testing.T) {
+	doc := `Usage: prog [--out=<dir>] <input>...
+
+Options:
+  --out=<dir>  Output directory [path: dir, exists]
+  <input>      Input files [path: file,exists,stdin-ok]`
+	a, err := Parse_annotations(doc)
+	if err != nil {
+		t.Fatalf("Parse_annotations: %v", err)
+	}
+	args := docopt.Opts{"--out": os.TempDir(), "<input>": []string{"-", "annotation_path.go"}}
+	if err := a.Apply(args); err != nil {
+		t.Errorf("Apply(): %v", err)
+	}
+	if inputs := args["<input>"].([]string); inputs[0] != "/dev/stdin" || inputs[1] != "annotation_path.go" {
+		t.Errorf("Apply(): got <input> %v", inputs)
+	}
+	args = docopt.Opts{"--out": "annotation_path.go", "<input>": []string{}}
+	if err := a.Apply(args); err == nil || err.Error() != "--out: not a directory: 'annotation_path.go'" {
+		t.Errorf("Apply(): got error %v", err)
+	}
+
+	for _, bad := range []string{
+		"Usage: prog [-v]\n\nOptions:\n  -v  [path: file]",
+		"Usage: prog <f>\n\nOptions:\n  <f>  [path: file,dir]",
+		"Usage: prog <f>\n\nOptions:\n  <f>  [path: fil]",
+	} {
+		if _, err := Parse_annotations(bad); err == nil {
+			t.Errorf("Parse_annotations(%q): no error", bad)
+		}
+	}
+}
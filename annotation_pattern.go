@@ -0,0 +1,58 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// annotation_pattern.go implements the annotations: [pattern: regexp] and
+// [pattern-message: text]
+//
+// The value of an option or an argument must match the regular expression,
+// as written: anchors are needed to match the whole value. The error names
+// the element and the pattern, or gives the message of [pattern-message: ].
+//
+//	<host>  Host name [pattern: ^[a-z0-9.-]+$] [pattern-message: not a host name]
+//
+package main
+
+import (
+	"fmt"
+	"github.com/docopt/docopt-go"
+	"regexp"
+)
+
+func init() {
+	Register_annotation("pattern", &Annotation_handler{
+		Phase:     Phase_check,
+		Has_value: true,
+		Compile: func(e *Annotated_element, value string) error {
+			if _, err := regexp.Compile(value); err != nil {
+				return err
+			}
+			return element_has_value(e)
+		},
+		Apply: func(e *Annotated_element, value string, args docopt.Opts) error {
+			re := regexp.MustCompile(value)
+			for _, v := range Element_values(args[e.Key]) {
+				if re.MatchString(v) {
+					continue
+				}
+				if message, found := e.Get("pattern-message"); found {
+					return fmt.Errorf("%s: %s: '%s'", e.Key, message, v)
+				}
+				return fmt.Errorf("%s: invalid value: '%s', must match: %s", e.Key, v, value)
+			}
+			return nil
+		},
+	})
+	Register_annotation("pattern-message", &Annotation_handler{
+		Phase:     Phase_check,
+		Has_value: true,
+		Compile: func(e *Annotated_element, value string) error {
+			if _, found := e.Get("pattern"); !found {
+				return fmt.Errorf("without [pattern: ]")
+			}
+			return nil
+		},
+		// used by [pattern: ]
+		Apply: func(e *Annotated_element, value string, args docopt.Opts) error {
+			return nil
+		},
+	})
+}
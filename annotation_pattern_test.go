@@ -0,0 +1,51 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// unit test for annotation_pattern.go
+//
+package main
+
+import (
+	"github.com/docopt/docopt-go"
+	"testing"
+)
+
+func TestAnnotation_pattern(t *testing.T) {
+	doc := `Usage: prog [--tag=<t>] [<host>...]
+
+Options:
+  --tag=<t>  Release tag [pattern: ^v[0-9]+\.[0-9]+$]
+  <host>     Host names [pattern: ^[a-z0-9-]+$] [pattern-message: not a host name]`
+	tables := []struct {
+		args       docopt.Opts
+		expect_err string
+	}{
+		{docopt.Opts{"--tag": "v1.2", "<host>": []string{"web-1", "db"}}, ""},
+		{docopt.Opts{"--tag": nil, "<host>": []string{}}, ""},
+		{docopt.Opts{"--tag": "1.2", "<host>": []string{}}, `--tag: invalid value: '1.2', must match: ^v[0-9]+\.[0-9]+$`},
+		{docopt.Opts{"--tag": nil, "<host>": []string{"web", "Web_2"}}, "<host>: not a host name: 'Web_2'"},
+	}
+	a, err := Parse_annotations(doc)
+	if err != nil {
+		t.Fatalf("Parse_annotations: %v", err)
+	}
+	for _, table := range tables {
+		err := a.Apply(table.args)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != table.expect_err {
+			t.Errorf("Apply(%v): got error %q, want %q", table.args, got, table.expect_err)
+		}
+	}
+
+	for _, bad := range []string{
+		"Usage: prog [-v]\n\nOptions:\n  -v  [pattern: ^a$]",
+		"Usage: prog <f>\n\nOptions:\n  <f>  [pattern: ^(a$]",
+		"Usage: prog <f>\n\nOptions:\n  <f>  [pattern-message: bad]",
+	} {
+		if _, err := Parse_annotations(bad); err == nil {
+			t.Errorf("Parse_annotations(%q): no error", bad)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// annotation_split.go implements the annotations: [split: SEP] and
+// [split-escape: C]
+//
+// The values of an option or an argument are split on SEP, the value is an
+// array, as if each part was given:
+//
+//	--tags=<t>  Tags [split: ,]      --tags=a,b --tags c   => tags=('a' 'b' 'c')
+//
+// The separator is kept if escaped by \ or the escape character given by
+// [split-escape: C], which is kept if doubled. [split-escape: none] disables
+// escaping.
+//
+package main
+
+import (
+	"fmt"
+	"github.com/docopt/docopt-go"
+	"strings"
+)
+
+func init() {
+	Register_annotation("split", &Annotation_handler{
+		Phase:     Phase_transform,
+		Has_value: true,
+		Compile: func(e *Annotated_element, value string) error {
+			return element_has_value(e)
+		},
+		Apply: func(e *Annotated_element, value string, args docopt.Opts) error {
+			escape := `\`
+			if c, found := e.Get("split-escape"); found {
+				escape = c
+			}
+			if escape == "none" {
+				escape = ""
+			}
+			parts := []string{}
+			for _, v := range Element_values(args[e.Key]) {
+				parts = append(parts, Split_escaped(v, value, escape)...)
+			}
+			args[e.Key] = parts
+			return nil
+		},
+	})
+	Register_annotation("split-escape", &Annotation_handler{
+		Phase:     Phase_transform,
+		Has_value: true,
+		Compile: func(e *Annotated_element, value string) error {
+			if _, found := e.Get("split"); !found {
+				return fmt.Errorf("without [split: ]")
+			}
+			if len([]rune(value)) != 1 && value != "none" {
+				return fmt.Errorf("a character or none is expected: %s", value)
+			}
+			return nil
+		},
+	})
+}
+
+// Split_escaped splits s on sep, unless sep follows escape. escape followed
+// by sep or by escape gives the character. No escape is "". An empty s gives
+// no part.
+func Split_escaped(s string, sep string, escape string) []string {
+	if s == "" {
+		return []string{}
+	}
+	if escape == "" {
+		return strings.Split(s, sep)
+	}
+	parts := []string{}
+	var current strings.Builder
+	for i := 0; i < len(s); {
+		switch {
+		case strings.HasPrefix(s[i:], escape+sep):
+			current.WriteString(sep)
+			i += len(escape + sep)
+		case strings.HasPrefix(s[i:], escape+escape):
+			current.WriteString(escape)
+			i += 2 * len(escape)
+		case strings.HasPrefix(s[i:], sep):
+			parts = append(parts, current.String())
+			current.Reset()
+			i += len(sep)
+		default:
+			current.WriteByte(s[i])
+			i++
+		}
+	}
+	return append(parts, current.String())
+}
@@ -0,0 +1,72 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// unit test for annotation_split.go
+//
+package main
+
+import (
+	"github.com/docopt/docopt-go"
+	"reflect"
+	"testing"
+)
+
+func TestSplit_escaped(t *testing.T) {
+	tables := []struct {
+		s      string
+		sep    string
+		escape string
+		expect []string
+	}{
+		{"a,b,c", ",", `\`, []string{"a", "b", "c"}},
+		{"", ",", `\`, []string{}},
+		{"a,,b,", ",", `\`, []string{"a", "", "b", ""}},
+		{`a\,b,c\\,d\x`, ",", `\`, []string{"a,b", `c\`, `d\x`}},
+		{`a\,b`, ",", "", []string{`a\`, "b"}},
+		{"a^:b::c", "::", "^", []string{"a^:b", "c"}},
+		{"a^::b^^::c", "::", "^", []string{"a::b^", "c"}},
+		{"é,à", ",", `\`, []string{"é", "à"}},
+	}
+	for _, table := range tables {
+		got := Split_escaped(table.s, table.sep, table.escape)
+		if !reflect.DeepEqual(got, table.expect) {
+			t.Errorf("Split_escaped(%q, %q, %q): got %q, want %q", table.s, table.sep, table.escape, got, table.expect)
+		}
+	}
+}
+
+func TestAnnotation_split(t *testing.T) {
+	doc := `Usage: prog [--tags=<t>...] [--path=<p>] [--ports=<n>]
+
+Options:
+  --tags=<t>   Tags [split: ,]
+  --path=<p>   Path [split: :] [split-escape: none]
+  --ports=<n>  Ports [split: ,] [type: int] [split-escape: %]`
+	args := docopt.Opts{"--tags": []string{"a,b", `c\,d`}, "--path": `/bin:/usr\:bin`, "--ports": "80,443%,"}
+	a, err := Parse_annotations(doc)
+	if err != nil {
+		t.Fatalf("Parse_annotations: %v", err)
+	}
+	expect := docopt.Opts{"--tags": []string{"a", "b", "c,d"}, "--path": []string{"/bin", `/usr\`, "bin"}, "--ports": []string{"80", "443,"}}
+	err = a.Apply(args)
+	if err == nil || err.Error() != "--ports: invalid int value: '443,'" {
+		t.Errorf("Apply(): got error %v", err)
+	}
+	args = docopt.Opts{"--tags": []string{"a,b", `c\,d`}, "--path": `/bin:/usr\:bin`, "--ports": nil}
+	expect["--ports"] = []string{}
+	if err := a.Apply(args); err != nil {
+		t.Errorf("Apply(): %v", err)
+	}
+	if !reflect.DeepEqual(args, expect) {
+		t.Errorf("Apply(): got %q, want %q", args, expect)
+	}
+
+	for _, bad := range []string{
+		"Usage: prog [-v]\n\nOptions:\n  -v  [split: ,]",
+		"Usage: prog <f>\n\nOptions:\n  <f>  [split-escape: ^]",
+		"Usage: prog <f>\n\nOptions:\n  <f>  [split: ,] [split-escape: ^^]",
+	} {
+		if _, err := Parse_annotations(bad); err == nil {
+			t.Errorf("Parse_annotations(%q): no error", bad)
+		}
+	}
+}
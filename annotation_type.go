@@ -0,0 +1,145 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// annotation_type.go implements the annotation: [type: int|float|bool|duration|size]
+//
+// The value is validated and converted, it is output unquoted:
+//
+//	--timeout=<t>  [type: duration]    10m     => timeout=600
+//	--max=<size>   [type: size]        1k      => max=1024
+//
+package main
+
+import (
+	"fmt"
+	"github.com/docopt/docopt-go"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Value_types converts a string value to the output value of each type.
+var Value_types = map[string]func(s string) (interface{}, error){
+	"int":      Parse_int,
+	"float":    Parse_float,
+	"bool":     Parse_bool,
+	"duration": Parse_duration,
+	"size":     Parse_size,
+}
+
+func init() {
+	Register_annotation("type", &Annotation_handler{
+		Phase:     Phase_convert,
+		Has_value: true,
+		Compile: func(e *Annotated_element, value string) error {
+			if _, found := Value_types[value]; !found {
+				return fmt.Errorf("unknown type: %s, types are: int, float, bool, duration, size", value)
+			}
+			return element_has_value(e)
+		},
+		Apply: func(e *Annotated_element, value string, args docopt.Opts) error {
+			convert := Value_types[value]
+			switch v := args[e.Key].(type) {
+			case string:
+				converted, err := convert(v)
+				if err != nil {
+					return fmt.Errorf("%s: invalid %s value: '%s'", e.Key, value, v)
+				}
+				args[e.Key] = converted
+			case []string:
+				// arrays stay arrays of strings, with normalized values
+				for i, s := range v {
+					converted, err := convert(s)
+					if err != nil {
+						return fmt.Errorf("%s: invalid %s value: '%s'", e.Key, value, s)
+					}
+					v[i] = To_string(converted)
+				}
+			}
+			return nil
+		},
+	})
+}
+
+// element_has_value returns an error for an option without argument, its
+// value is a bool or a counter.
+func element_has_value(e *Annotated_element) error {
+	if e.Option != nil && e.Option.Argcount == 0 {
+		return fmt.Errorf("only for an option with an argument or an argument")
+	}
+	return nil
+}
+
+func Parse_int(s string) (interface{}, error) {
+	return strconv.Atoi(s)
+}
+
+func Parse_float(s string) (interface{}, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err == nil && (math.IsNaN(f) || math.IsInf(f, 0)) {
+		return nil, fmt.Errorf("not a number: %s", s)
+	}
+	return f, err
+}
+
+func Parse_bool(s string) (interface{}, error) {
+	switch strings.ToLower(s) {
+	case "true", "yes", "on", "1":
+		return true, nil
+	case "false", "no", "off", "0":
+		return false, nil
+	}
+	return nil, fmt.Errorf("not a bool: %s", s)
+}
+
+// Parse_duration returns seconds: an int if whole, else a float64. An integer
+// is seconds, else units are Go's: 1h30m, 10m, 1.5s, 300ms...
+func Parse_duration(s string) (interface{}, error) {
+	if seconds, err := strconv.Atoi(s); err == nil {
+		return seconds, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return nil, err
+	}
+	return whole_number(d.Seconds())
+}
+
+// Parse_size returns bytes. Units K, M, G, T, P are powers of 1024, written
+// alone or KiB, MiB...; kB, MB... are powers of 1000. B is bytes.
+func Parse_size(s string) (interface{}, error) {
+	m := regexp.MustCompile(`^(\d+(?:\.\d+)?)([kKMGTP]?)(i?)(B?)$`).FindStringSubmatch(s)
+	if m == nil || (m[2] == "" && m[3] != "") {
+		return nil, fmt.Errorf("not a size: %s", s)
+	}
+	size, _ := strconv.ParseFloat(m[1], 64)
+	base := 1024.0
+	if m[3] == "" && m[4] == "B" {
+		base = 1000.0
+	}
+	power := 0
+	if m[2] != "" {
+		power = strings.Index("KMGTP", strings.ToUpper(m[2])) + 1
+	}
+	size *= math.Pow(base, float64(power))
+	if size >= float64(int(^uint(0)>>1)) {
+		return nil, fmt.Errorf("size too large: %s", s)
+	}
+	return int(size), nil
+}
+
+func whole_number(f float64) (interface{}, error) {
+	if f == math.Trunc(f) && math.Abs(f) < float64(int(^uint(0)>>1)) {
+		return int(f), nil
+	}
+	return f, nil
+}
+
+// To_string formats a parsed value as it is output, without quote.
+func To_string(v interface{}) string {
+	if f, ok := v.(float64); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return fmt.Sprintf("%v", v)
+}
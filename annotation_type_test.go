@@ -0,0 +1,96 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// unit test for annotation_type.go
+//
+package main
+
+import (
+	"github.com/docopt/docopt-go"
+	"reflect"
+	"testing"
+)
+
+func TestValue_types(t *testing.T) {
+	tables := []struct {
+		value_type string
+		s          string
+		expect     interface{}
+		expect_err bool
+	}{
+		{"int", "42", 42, false},
+		{"int", "-3", -3, false},
+		{"int", "4.2", nil, true},
+		{"float", "2.50", 2.5, false},
+		{"float", "NaN", nil, true},
+		{"float", "abc", nil, true},
+		{"bool", "Yes", true, false},
+		{"bool", "off", false, false},
+		{"bool", "maybe", nil, true},
+		{"duration", "10m", 600, false},
+		{"duration", "90", 90, false},
+		{"duration", "1h30m", 5400, false},
+		{"duration", "1.5s", 1.5, false},
+		{"duration", "10 minutes", nil, true},
+		{"size", "512", 512, false},
+		{"size", "1k", 1024, false},
+		{"size", "2MiB", 2097152, false},
+		{"size", "1MB", 1000000, false},
+		{"size", "1.5K", 1536, false},
+		{"size", "10B", 10, false},
+		{"size", "1iB", nil, true},
+		{"size", "-1k", nil, true},
+		{"size", "8191P", 9222246136947933184, false},
+		{"size", "8192P", nil, true},
+	}
+	for _, table := range tables {
+		got, err := Value_types[table.value_type](table.s)
+		if (err != nil) != table.expect_err {
+			t.Errorf("%s(%q): got error %v, want error: %v", table.value_type, table.s, err, table.expect_err)
+			continue
+		}
+		if err == nil && got != table.expect {
+			t.Errorf("%s(%q): got %#v, want %#v", table.value_type, table.s, got, table.expect)
+		}
+	}
+}
+
+func TestAnnotation_type(t *testing.T) {
+	doc := `Usage: prog [--speed=<kn>] [--timeout=<t>] [<n>...]
+
+Options:
+  --speed=<kn>    Speed [type: float]
+  --timeout=<t>   [type: duration]
+  <n>             [type: int]`
+	tables := []struct {
+		args       docopt.Opts
+		expect     docopt.Opts
+		expect_err bool
+	}{
+		{
+			docopt.Opts{"--speed": "2.0", "--timeout": "1m", "<n>": []string{"1", "02"}},
+			docopt.Opts{"--speed": 2.0, "--timeout": 60, "<n>": []string{"1", "2"}},
+			false,
+		},
+		{
+			docopt.Opts{"--speed": nil, "--timeout": nil, "<n>": []string{}},
+			docopt.Opts{"--speed": nil, "--timeout": nil, "<n>": []string{}},
+			false,
+		},
+		{docopt.Opts{"--speed": "fast", "--timeout": nil, "<n>": []string{}}, nil, true},
+		{docopt.Opts{"--speed": nil, "--timeout": nil, "<n>": []string{"1", "x"}}, nil, true},
+	}
+	a, err := Parse_annotations(doc)
+	if err != nil {
+		t.Fatalf("Parse_annotations: %v", err)
+	}
+	for _, table := range tables {
+		err := a.Apply(table.args)
+		if (err != nil) != table.expect_err {
+			t.Errorf("Apply(): got error %v, want error: %v", err, table.expect_err)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(table.args, table.expect) {
+			t.Errorf("Apply(): got %v, want %v", table.args, table.expect)
+		}
+	}
+}
@@ -0,0 +1,671 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// annotations.go reads the annotations of a usage: [name: value] or [name]
+// written in the descriptions of the Options: sections, as [default: x].
+//
+//	Options:
+//	  --speed=<kn>  Speed in knots [type: float].
+//	  <count>       How many [type: int].
+//
+// Descriptions of arguments (<arg> or ARG) are written in the Options:
+// sections too, docopt ignores them. Once docopt has parsed argv, each
+// annotation handler checks or converts the value of its element. Only the
+// registered annotation names are recognized, other bracketed text is left
+// as it is.
+//
+package main
+
+import (
+	"fmt"
+	"github.com/docopt/docopt-go"
+	"github.com/docopt/docopts/docopt_engine"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Handlers are applied phase after phase, in the order of the elements.
+const (
+	// the value is filled from another source than argv
+	Phase_fill = iota
+	// the value is reshaped: split, renamed...
+	Phase_transform
+	// the value is checked
+	Phase_check
+	// the value is converted for output
+	Phase_convert
+)
+
+// An Annotation_handler checks or converts the parsed value of an element.
+type Annotation_handler struct {
+	Phase int
+	// the annotation is written [name: value], else [name]
+	Has_value bool
+	// Compile checks the annotation when the usage is read, it is optional.
+	// An error there is an error in the usage, as docopt's language errors.
+	Compile func(e *Annotated_element, value string) error
+	// Apply is called once docopt has parsed argv, for elements found in
+	// args. An error is a usage error of the user. It is optional.
+	Apply func(e *Annotated_element, value string, args docopt.Opts) error
+	// Warn returns a warning about an element given, on argv or by another
+	// source, before Phase_transform. It is optional.
+	Warn func(e *Annotated_element, value string) string
+	// A Fill handler gives the value of an element not given on argv, it is
+	// applied in Phase_fill before the [default: x] of the option.
+	Fill bool
+}
+
+var annotation_handlers = map[string]*Annotation_handler{}
+
+// Register_annotation is called from an init() in the source file of each
+// annotation.
+func Register_annotation(name string, h *Annotation_handler) {
+	annotation_handlers[name] = h
+}
+
+// Annotation_names returns the registered annotation names, sorted.
+func Annotation_names() []string {
+	names := make([]string, 0, len(annotation_handlers))
+	for name := range annotation_handlers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type Annotation struct {
+	Name  string
+	Value string
+}
+
+// An option or an argument described with annotations.
+type Annotated_element struct {
+	// the key in the parsed docopt.Opts: --long, -s, <arg> or ARG
+	Key string
+	// the option description, nil for an argument
+	Option      *Option_desc
+	Annotations []*Annotation
+	// the element can be repeated: its value is an array or a counter. True
+	// if the usage cannot be parsed, docopt reports the error.
+	Repeated bool
+	// [default: x] is removed from the usage given to docopt
+	default_removed bool
+	// the lines of its description in the usage
+	entry []int
+	// the usage it is described in
+	usage *Annotated_usage
+	// written --[no-]name, see negatable.go
+	Negatable bool
+}
+
+// Get returns the value of the annotation name, and true if found.
+func (e *Annotated_element) Get(name string) (string, bool) {
+	for _, a := range e.Annotations {
+		if a.Name == name {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+type Annotated_usage struct {
+	// the usage given to docopt: annotations are removed, docopt doesn't
+	// see them, and the [default: x] of the elements filled by another source
+	Doc string
+	// the usage as written, without the [hidden] elements, displayed for
+	// --help
+	Help string
+	// the "usage:" section, displayed with a usage error
+	Usage    string
+	Elements []*Annotated_element
+	// warnings for the user found by Apply(), to display on stderr
+	Warnings []string
+	// the environment read by [env: NAME], nil for the environment of
+	// docopts, see lookup_env()
+	Env map[string]string
+	// the current directory relative paths are relative to, "" for the one
+	// of docopts: a server resolves paths in the directory of its client
+	Dir string
+	// the argv parsed by docopt, see Prepare_argv()
+	Argv          []string
+	options_first bool
+	// a config file to load, see config.go
+	Config_file string
+	// the option annotated [config: path], if any
+	config_element *Annotated_element
+	config         Config
+	// Doc compiled, and the usage model read from it, nil if not needed by
+	// the annotations, see Compile()
+	cache    *Usage_cache
+	compiled *docopt_engine.Usage
+	model    *Usage_model
+	// the Constraints: section, see constraints.go
+	constraints []*Constraint
+	// the lines of Doc, and the lines of each options entry
+	lines   []string
+	entries [][]int
+	// where the value of the elements filled by another source comes from:
+	// argv, default or the source, see Sources()
+	sources map[string]string
+}
+
+// Parse_annotations reads the annotations of doc. A doc without annotation
+// gives no element, Doc is doc and Apply() does nothing.
+func Parse_annotations(doc string) (*Annotated_usage, error) {
+	return Parse_annotations_cached(doc, nil)
+}
+
+// Parse_annotations_cached is Parse_annotations(), Doc is compiled by cache
+// if not nil. Doc is compiled only if the annotations or the constraints need
+// the usage parsed, see Compile().
+func Parse_annotations_cached(doc string, cache *Usage_cache) (*Annotated_usage, error) {
+	a := &Annotated_usage{Doc: doc, Help: doc, sources: make(map[string]string), cache: cache}
+	if usage := Parse_section("usage:", doc); len(usage) > 0 {
+		a.Usage = usage[0]
+	}
+	a.lines = strings.Split(doc, "\n")
+	a.entries = Options_entries(a.lines)
+	negatables := a.rewrite_negatables()
+	optional_values := a.rewrite_optional_values()
+	if len(negatables) > 0 || len(optional_values) > 0 {
+		a.Doc = strings.Join(a.lines, "\n")
+	}
+
+	// the lines of the [hidden] elements are removed from Help
+	hidden := make(map[int]bool)
+	for _, entry := range a.entries {
+		annotations := []*Annotation{}
+		for _, i := range entry {
+			found, stripped, err := parse_line_annotations(a.lines[i])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", strings.Fields(a.lines[entry[0]])[0], err)
+			}
+			annotations = append(annotations, found...)
+			a.lines[i] = stripped
+		}
+		if len(annotations) == 0 && !negatables[entry[0]] && !optional_values[entry[0]] {
+			continue
+		}
+
+		e := a.new_element(entry)
+		e.Annotations = annotations
+		if negatables[entry[0]] {
+			if err := a.compile_negatable(e); err != nil {
+				return nil, err
+			}
+		}
+		if _, found := e.Get("default-if-present"); optional_values[entry[0]] && !found {
+			return nil, fmt.Errorf("%s: [default-if-present: value] is expected", e.Key)
+		}
+		for _, an := range annotations {
+			if annotation_handlers[an.Name].Fill {
+				// the default is applied by Apply(), after the other sources
+				a.remove_default(e)
+			}
+			if an.Name == "config" {
+				a.config_element = e
+			}
+			if an.Name == "hidden" {
+				for _, i := range entry {
+					hidden[i] = true
+				}
+			}
+		}
+	}
+	if a.config_element != nil {
+		a.Remove_defaults()
+	}
+	if len(a.Elements) > 0 {
+		a.Doc = strings.Join(a.lines, "\n")
+	}
+	if len(hidden) > 0 {
+		a.Help = hide_lines(doc, hidden)
+	}
+
+	if len(a.Elements) == 0 && !re_constraints_section.MatchString(a.Doc) {
+		return a, nil
+	}
+	// the usage given to docopt is compiled once, see parse_args()
+	if _, err := a.Compile(); err != nil {
+		return nil, err
+	}
+	for _, e := range a.Elements {
+		e.Repeated = a.model.Repeated[e.Key]
+		for _, an := range e.Annotations {
+			h := annotation_handlers[an.Name]
+			if h.Compile == nil {
+				continue
+			}
+			if err := h.Compile(e, an.Value); err != nil {
+				return nil, fmt.Errorf("%s: [%s]: %v", e.Key, an.Name, err)
+			}
+		}
+	}
+	var err error
+	if a.constraints, err = Parse_constraints(a.Doc, a.model); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Compile returns Doc compiled, by the cache given to
+// Parse_annotations_cached() if any, and reads the usage model from it. Doc
+// is compiled again only if it changed, see Remove_defaults().
+func (a *Annotated_usage) Compile() (*docopt_engine.Usage, error) {
+	if a.compiled != nil && a.compiled.Doc() == a.Doc {
+		return a.compiled, nil
+	}
+	var u *docopt_engine.Usage
+	var err error
+	if a.cache != nil {
+		u, err = a.cache.Get(a.Doc)
+	} else {
+		u, err = docopt_engine.Compile(a.Doc)
+	}
+	if err != nil {
+		return nil, err
+	}
+	a.compiled = u
+	a.model = New_usage_model(u)
+	return u, nil
+}
+
+// Model returns the Usage_model of the usage as docopts outputs it: the
+// usage given to docopt, without the --no-name of the negatable options.
+func (a *Annotated_usage) Model() (*Usage_model, error) {
+	if _, err := a.Compile(); err != nil {
+		return nil, err
+	}
+	m := New_usage_model(a.compiled)
+	for _, e := range a.Elements {
+		if e.Negatable {
+			m.remove_leaf("--no-" + strings.TrimPrefix(e.Key, "--"))
+		}
+	}
+	return m, nil
+}
+
+// Parse_annotated_usage returns the Model() of doc.
+func Parse_annotated_usage(doc string) (*Usage_model, error) {
+	a, err := Parse_annotations(doc)
+	if err != nil {
+		return nil, err
+	}
+	return a.Model()
+}
+
+// new_element adds the element described by entry.
+func (a *Annotated_usage) new_element(entry []int) *Annotated_element {
+	text := entry_text(a.lines, entry)
+	e := &Annotated_element{entry: entry, usage: a}
+	if strings.HasPrefix(text, "-") {
+		e.Option = Parse_option(text)
+		e.Key = e.Option.Name()
+	} else {
+		e.Key = strings.Fields(text)[0]
+	}
+	a.Elements = append(a.Elements, e)
+	return e
+}
+
+// remove_default removes the [default: x] of the option e from the usage
+// given to docopt.
+func (a *Annotated_usage) remove_default(e *Annotated_element) {
+	if e.Option == nil || !e.Option.Has_default || e.default_removed {
+		return
+	}
+	re_default := regexp.MustCompile(`(?i)\[default: (.*)\]`)
+	for _, i := range e.entry {
+		a.lines[i] = re_default.ReplaceAllString(a.lines[i], "")
+	}
+	e.default_removed = true
+}
+
+// Remove_defaults removes the [default: x] of all options, their default is
+// applied by Apply() after the other sources: the config file.
+func (a *Annotated_usage) Remove_defaults() {
+	found := make(map[int]bool)
+	for _, e := range a.Elements {
+		a.remove_default(e)
+		found[e.entry[0]] = true
+	}
+	for _, entry := range a.entries {
+		if found[entry[0]] || !strings.HasPrefix(entry_text(a.lines, entry), "-") {
+			continue
+		}
+		e := a.new_element(entry)
+		if !e.Option.Has_default {
+			// only elements which can be filled are kept
+			a.Elements = a.Elements[:len(a.Elements)-1]
+			continue
+		}
+		a.remove_default(e)
+	}
+	a.Doc = strings.Join(a.lines, "\n")
+}
+
+// Help_handler wraps the HelpHandler of a parser given a.Doc, so --help
+// displays a.Help, and a usage error displays the "usage:" section as
+// written, a.Usage, not the one rewritten for docopt.
+func (a *Annotated_usage) Help_handler(handler func(err error, usage string)) func(err error, usage string) {
+	rewritten := ""
+	if usage := Parse_section("usage:", a.Doc); len(usage) > 0 && usage[0] != a.Usage {
+		rewritten = usage[0]
+	}
+	return func(err error, usage string) {
+		if err == nil && usage == strings.Trim(a.Doc, "\n") {
+			usage = strings.Trim(a.Help, "\n")
+		}
+		// docopt displays its error followed by the usage section
+		if err != nil && rewritten != "" && strings.HasSuffix(usage, rewritten) {
+			usage = strings.TrimSuffix(usage, rewritten) + a.Usage
+		}
+		handler(err, usage)
+	}
+}
+
+// Parse_argv parses argv as docopts does: argv is prepared, parsed with the
+// usage given to docopt, then the annotations are applied. A usage error found
+// by Apply() is given to the HelpHandler of parser, with the usage as written.
+// Wrap the HelpHandler with Help_handler() first.
+func (a *Annotated_usage) Parse_argv(parser *docopt_engine.Parser, argv []string, version string) (docopt.Opts, error) {
+	args, err := parse_args(parser, a, a.Prepare_argv(argv, parser.OptionsFirst), version)
+	if err != nil || args == nil {
+		return args, err
+	}
+	if err := a.Apply(args); err != nil {
+		parser.HelpHandler(err, a.Usage)
+		return nil, err
+	}
+	return args, nil
+}
+
+// Apply runs the annotation handlers on the parsed args, which are modified
+// in place. The error is a usage error, to be reported with a.Usage.
+func (a *Annotated_usage) Apply(args docopt.Opts) error {
+	if err := a.load_config(args); err != nil {
+		return err
+	}
+	for _, phase := range []int{Phase_fill, Phase_transform, Phase_check, Phase_convert} {
+		if phase == Phase_transform {
+			a.Warnings = a.warnings(args)
+		}
+		if phase == Phase_check {
+			if err := a.Check_constraints(args); err != nil {
+				return err
+			}
+		}
+		for _, e := range a.Elements {
+			if _, found := args[e.Key]; !found {
+				continue
+			}
+			if phase == Phase_fill {
+				fill := a.fill
+				if e.Negatable {
+					fill = a.fill_negatable
+				}
+				if err := fill(e, args); err != nil {
+					return err
+				}
+				continue
+			}
+			for _, an := range e.Annotations {
+				h := annotation_handlers[an.Name]
+				if h.Phase != phase || h.Apply == nil {
+					continue
+				}
+				if err := h.Apply(e, an.Value, args); err != nil {
+					return err
+				}
+			}
+		}
+		if phase == Phase_fill {
+			if err := a.fill_config(args); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// fill gives the value of an element not given on argv: by the Fill
+// handlers, in the order of the annotations, then by the removed default.
+func (a *Annotated_usage) fill(e *Annotated_element, args docopt.Opts) error {
+	fillable := e.default_removed || e.Negatable || (a.config != nil && e.Option != nil)
+	for _, an := range e.Annotations {
+		fillable = fillable || annotation_handlers[an.Name].Fill
+	}
+	if _, filled := a.sources[e.Key]; filled || !fillable {
+		return nil
+	}
+	if !Is_missing(args[e.Key]) {
+		a.sources[e.Key] = "argv"
+		return nil
+	}
+	for _, an := range e.Annotations {
+		if !annotation_handlers[an.Name].Fill {
+			continue
+		}
+		if err := annotation_handlers[an.Name].Apply(e, an.Value, args); err != nil {
+			return err
+		}
+		if !Is_missing(args[e.Key]) {
+			a.sources[e.Key] = fmt.Sprintf("[%s: %s]", an.Name, an.Value)
+			return nil
+		}
+	}
+	if value, found := a.config[e.Key]; found {
+		filled, err := Config_value(args[e.Key], value)
+		if err != nil {
+			return fmt.Errorf("%s: config file %s: %v", e.Key, a.Config_file, err)
+		}
+		args[e.Key] = filled
+		a.sources[e.Key] = "config " + a.Config_file
+		return nil
+	}
+	if e.default_removed {
+		if _, is_array := args[e.Key].([]string); is_array {
+			args[e.Key] = strings.Fields(e.Option.Default)
+		} else {
+			args[e.Key] = e.Option.Default
+		}
+		a.sources[e.Key] = "default"
+	} else {
+		a.sources[e.Key] = "not given"
+	}
+	return nil
+}
+
+// warnings returns the warnings of the elements given.
+func (a *Annotated_usage) warnings(args docopt.Opts) []string {
+	warnings := []string{}
+	for _, e := range a.Elements {
+		if !a.is_given(e.Key, args) {
+			continue
+		}
+		for _, an := range e.Annotations {
+			h := annotation_handlers[an.Name]
+			if h.Warn == nil {
+				continue
+			}
+			if w := h.Warn(e, an.Value); w != "" {
+				warnings = append(warnings, w)
+			}
+		}
+	}
+	return warnings
+}
+
+// hide_lines removes the lines of doc found in hidden. A header line is kept,
+// up to the ':'.
+func hide_lines(doc string, hidden map[int]bool) string {
+	lines := []string{}
+	for i, line := range strings.Split(doc, "\n") {
+		if !hidden[i] {
+			lines = append(lines, line)
+		} else if Match(`(?i)options:`, line) {
+			header, _, _ := string_partition(line, ":")
+			lines = append(lines, header+":")
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Sources returns, for the elements which can be filled by another source
+// than argv, where their value comes from: argv, default or the annotation.
+func (a *Annotated_usage) Sources() map[string]string {
+	sources := make(map[string]string)
+	for key, source := range a.sources {
+		sources[key] = source
+	}
+	return sources
+}
+
+// Is_missing returns true for the value of an element not given: nil, an
+// empty array or map, false for a flag or 0 for a counter.
+func Is_missing(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case []string:
+		return len(v) == 0
+	case map[string]string:
+		return len(v) == 0
+	case bool:
+		return !v
+	case int:
+		return v == 0
+	}
+	return false
+}
+
+// Options_entries returns the option and argument descriptions found in the
+// options: sections of lines, each as the indexes of its lines. An entry
+// starts with an option or with an argument followed by two spaces or the end
+// of line, the following lines are its continuation.
+func Options_entries(lines []string) [][]int {
+	entries := [][]int{}
+	re_argument := regexp.MustCompile(`^(<[^>]+>|[A-Z][A-Z0-9_-]*)(\s{2,}|$)`)
+	for i := 0; i < len(lines); i++ {
+		if !Match(`(?i)options:`, lines[i]) {
+			continue
+		}
+		// the header line, as Parse_section and Parse_options do
+		end := section_end(lines, i)
+		for j := i; j < end; j++ {
+			line := strings.TrimSpace(lines[j])
+			if j == i {
+				_, _, line = string_partition(line, ":")
+				line = strings.TrimSpace(line)
+			}
+			switch {
+			case strings.HasPrefix(line, "-") || re_argument.MatchString(line):
+				entries = append(entries, []int{j})
+			case len(entries) > 0 && line != "" && j > i:
+				last := len(entries) - 1
+				entries[last] = append(entries[last], j)
+			}
+		}
+		i = end - 1
+	}
+	return entries
+}
+
+// entry_text returns the description of an entry as one text, each line
+// trimmed. The text of a header line is after "options:".
+func entry_text(lines []string, entry []int) string {
+	text := []string{}
+	for _, i := range entry {
+		line := lines[i]
+		if Match(`(?i)options:`, line) {
+			_, _, line = string_partition(line, ":")
+		}
+		text = append(text, strings.TrimSpace(line))
+	}
+	return strings.Join(text, "\n")
+}
+
+// entry_options returns the options of an entry, the words of its first line
+// before the description: -c, --color gives -c and --color.
+func entry_options(lines []string, entry []int) []string {
+	options, _, _ := string_partition(entry_text(lines, entry[:1]), "  ")
+	return strings.Fields(strings.Replace(options, ",", " ", -1))
+}
+
+// parse_line_annotations finds the registered annotations of a line, and
+// returns the line without them. The value ends at the matching bracket:
+// [pattern: ^[a-z]+$] is supported.
+func parse_line_annotations(line string) ([]*Annotation, string, error) {
+	annotations := []*Annotation{}
+	re_start := regexp.MustCompile(`\[([a-z][a-z-]*)(:|\])`)
+	stripped := ""
+	for rest := line; ; {
+		m := re_start.FindStringSubmatchIndex(rest)
+		if m == nil {
+			return annotations, stripped + rest, nil
+		}
+		name := rest[m[2]:m[3]]
+		h, registered := annotation_handlers[name]
+		if !registered {
+			stripped += rest[:m[3]]
+			rest = rest[m[3]:]
+			continue
+		}
+
+		an := &Annotation{Name: name}
+		// a single space before the annotation is removed, not the two
+		// spaces separating an option from its description
+		before := rest[:m[0]]
+		if strings.HasSuffix(before, " ") && !strings.HasSuffix(before, "  ") {
+			before = before[:len(before)-1]
+		}
+		stripped += before
+		if rest[m[4]:m[5]] == ":" {
+			end := matching_bracket(rest, m[5])
+			if end < 0 {
+				return nil, "", fmt.Errorf("unmatched '[' in: [%s: ...", name)
+			}
+			an.Value = strings.TrimSpace(rest[m[5]:end])
+			rest = rest[end+1:]
+		} else {
+			rest = rest[m[5]:]
+		}
+		if h.Has_value && an.Value == "" {
+			return nil, "", fmt.Errorf("[%s]: a value is expected: [%s: ...]", name, name)
+		}
+		if !h.Has_value && an.Value != "" {
+			return nil, "", fmt.Errorf("[%s: %s]: no value is expected: [%s]", name, an.Value, name)
+		}
+		annotations = append(annotations, an)
+	}
+}
+
+// matching_bracket returns the index of the ']' closing the '[' opened
+// before start, or -1.
+func matching_bracket(s string, start int) int {
+	depth := 0
+	for i := start; i < len(s); i++ {
+		switch s[i] {
+		case '[':
+			depth++
+		case ']':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		}
+	}
+	return -1
+}
+
+// Element_values returns the parsed values of an element as a list: one value
+// for a string, the values of an array, none if the element was not given.
+func Element_values(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	}
+	return []string{}
+}
@@ -0,0 +1,176 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// unit test for annotations.go
+//
+package main
+
+import (
+	"github.com/docopt/docopts/docopt_engine"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOptions_entries(t *testing.T) {
+	doc := `Usage: prog [options] <file> FILE
+
+Options: -q  Quiet
+  -v, --verbose  Verbose
+                 [type: bool] on a continuation line.
+  <file>         A file.
+  FILE           Another file.
+  The end of the text.
+
+Not an option.`
+	expect := [][]int{{2}, {3, 4}, {5}, {6, 7}}
+	if got := Options_entries(strings.Split(doc, "\n")); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Options_entries(): got %v, want %v", got, expect)
+	}
+}
+
+func TestParse_annotations(t *testing.T) {
+	tables := []struct {
+		doc        string
+		expect     map[string][]Annotation
+		expect_err bool
+	}{
+		{
+			"Usage: prog [--speed=<kn>] <n>\n\nOptions:\n  --speed=<kn>  Speed [type: float] [default: 1] [see: x].\n  <n>  Count\n       [type: int]",
+			map[string][]Annotation{
+				"--speed": {{"type", "float"}},
+				"<n>":     {{"type", "int"}},
+			},
+			false,
+		},
+		{"Usage: prog [-v]\n\nOptions:\n  -v  Verbose.", map[string][]Annotation{}, false},
+		{"Usage: prog [-v]\n\nOptions:\n  -v  Verbose [type: int].", nil, true},
+		{"Usage: prog [-s=<x>]\n\nOptions:\n  -s=<x>  [type: unknown].", nil, true},
+		{"Usage: prog [-s=<x>]\n\nOptions:\n  -s=<x>  [type].", nil, true},
+		{"Usage: prog [-s=<x>]\n\nOptions:\n  -s=<x>  [type: int", nil, true},
+	}
+	for _, table := range tables {
+		a, err := Parse_annotations(table.doc)
+		if (err != nil) != table.expect_err {
+			t.Errorf("Parse_annotations(%q): got error %v, want error: %v", table.doc, err, table.expect_err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		got := map[string][]Annotation{}
+		for _, e := range a.Elements {
+			for _, an := range e.Annotations {
+				got[e.Key] = append(got[e.Key], *an)
+			}
+		}
+		if !reflect.DeepEqual(got, table.expect) {
+			t.Errorf("Parse_annotations(%q): got %v, want %v", table.doc, got, table.expect)
+		}
+		if a.Help != table.doc {
+			t.Errorf("Parse_annotations(%q): Help changed: %q", table.doc, a.Help)
+		}
+	}
+}
+
+func TestMatching_bracket(t *testing.T) {
+	tables := []struct {
+		s      string
+		start  int
+		expect int
+	}{
+		{"[x: abc]", 3, 7},
+		{"[x: ^[a-z]+$] [y]", 3, 12},
+		{"[x: [unmatched", 3, -1},
+	}
+	for _, table := range tables {
+		if got := matching_bracket(table.s, table.start); got != table.expect {
+			t.Errorf("matching_bracket(%q, %d): got %d, want %d", table.s, table.start, got, table.expect)
+		}
+	}
+}
+
+func TestParse_annotations_doc(t *testing.T) {
+	tables := []struct {
+		doc    string
+		expect string
+	}{
+		{"Usage: prog\n\nOptions:\n  -v  Verbose.", "Usage: prog\n\nOptions:\n  -v  Verbose."},
+		{
+			"Usage: prog\n\nOptions:\n  --x=<x>  [default: 1] [type: int] [see: y]\n  <n>      [type: int]",
+			"Usage: prog\n\nOptions:\n  --x=<x>  [default: 1] [see: y]\n  <n>      ",
+		},
+		{
+			// an option filled by the environment has no default for docopt
+			"Usage: prog\n\nOptions:\n  --x=<x>  X [default: 1] [env: X]",
+			"Usage: prog\n\nOptions:\n  --x=<x>  X ",
+		},
+	}
+	for _, table := range tables {
+		a, err := Parse_annotations(table.doc)
+		if err != nil {
+			t.Errorf("Parse_annotations(%q): %v", table.doc, err)
+			continue
+		}
+		if a.Doc != table.expect {
+			t.Errorf("Parse_annotations(%q): got Doc %q, want %q", table.doc, a.Doc, table.expect)
+		}
+	}
+}
+
+func TestHelp_handler(t *testing.T) {
+	doc := "Usage: prog [--x=<x>]\n\nOptions:\n  --x=<x>  [type: int]\n"
+	a, err := Parse_annotations(doc)
+	if err != nil {
+		t.Fatalf("Parse_annotations: %v", err)
+	}
+	got := ""
+	handler := a.Help_handler(func(err error, usage string) { got = usage })
+	handler(nil, strings.Trim(a.Doc, "\n"))
+	if got != strings.Trim(doc, "\n") {
+		t.Errorf("Help_handler(): got %q, want %q", got, doc)
+	}
+	handler(nil, "version 1")
+	if got != "version 1" {
+		t.Errorf("Help_handler(): got %q, want the version", got)
+	}
+
+	// a usage error displays the usage as written, not the one given to docopt
+	a, err = Parse_annotations("Usage: prog [--[no-]color]\n\nOptions:\n  --[no-]color  Color.\n")
+	if err != nil {
+		t.Fatalf("Parse_annotations: %v", err)
+	}
+	parser := &docopt_engine.Parser{HelpHandler: a.Help_handler(func(err error, usage string) { got = usage })}
+	parser.ParseDoc(a.Doc, []string{"extra"}, "")
+	if got != "Usage: prog [--[no-]color]" {
+		t.Errorf("Help_handler() on error: got %q, want the usage as written", got)
+	}
+}
+
+func TestAnnotated_usage_compile(t *testing.T) {
+	// without annotation, the usage is compiled only to parse argv
+	a, err := Parse_annotations("Usage: prog [-v]")
+	if err != nil || a.compiled != nil {
+		t.Errorf("Parse_annotations without annotation: compiled %v, err: %v", a.compiled, err)
+	}
+
+	// the usage compiled for the annotations is the one parsing argv
+	cache := New_usage_cache()
+	doc := "Usage: prog [-v] <n>\n\nOptions:\n  <n>  N [type: int]"
+	a, err = Parse_annotations_cached(doc, cache)
+	if err != nil || a.compiled == nil || a.model == nil {
+		t.Fatalf("Parse_annotations_cached: compiled %v, err: %v", a.compiled, err)
+	}
+	u, err := a.Compile()
+	if err != nil || u != a.compiled || len(cache.usages) != 1 {
+		t.Errorf("Compile: compiled again %v, cache %v, err: %v", u, cache.usages, err)
+	}
+	args, err := parse_args(&docopt_engine.Parser{}, a, []string{"3"}, "")
+	if err != nil || args["<n>"] != "3" || len(cache.usages) != 1 {
+		t.Errorf("parse_args: got %v, cache %v, err: %v", args, cache.usages, err)
+	}
+
+	// a malformed usage is reported
+	if _, err := Parse_annotations("Usage: prog (<n>\n\nOptions:\n  <n>  N [type: int]"); err == nil {
+		t.Errorf("Parse_annotations: expecting an error on a malformed usage")
+	}
+}
@@ -0,0 +1,304 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// config.go fills the options not given on argv from a config file: JSON,
+// TOML or INI, whose keys are long option names without the leading --.
+// argv > env > config file > default.
+//
+// The file is given to docopts with --config=<file>, or by the option of the
+// usage annotated [config: path]: its value is the file, path is the default
+// file, ignored if not found:
+//
+//	--conf=<file>  Config file [config: ~/.mytool.ini]
+//
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/docopt/docopt-go"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Config is the values of a config file: long option name => values.
+type Config map[string][]string
+
+func init() {
+	Register_flag("--config")
+	Register_annotation("config", &Annotation_handler{
+		Phase:     Phase_fill,
+		Has_value: true,
+		Compile: func(e *Annotated_element, value string) error {
+			if e.Option == nil || e.Option.Argcount == 0 {
+				return fmt.Errorf("only for an option with an argument")
+			}
+			return nil
+		},
+		// the file is loaded by Apply(), before the elements are filled
+	})
+}
+
+// load_config loads Config_file, or the file given by the option annotated
+// [config: path]. Keys must be options of args.
+func (a *Annotated_usage) load_config(args docopt.Opts) error {
+	filename := a.Config_file
+	required := filename != ""
+	if e := a.config_element; filename == "" && e != nil {
+		if err := a.fill(e, args); err != nil {
+			return err
+		}
+		if given, ok := args[e.Key].(string); ok {
+			filename, required = given, true
+		} else {
+			path, _ := e.Get("config")
+			filename = a.expand_home(path)
+		}
+	}
+	if filename == "" {
+		return nil
+	}
+
+	config, err := Load_config(join_dir(a.Dir, filename))
+	if err != nil {
+		if !required && os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("config file %s: %v", filename, err)
+	}
+	for key := range config {
+		if _, found := args[key]; !found || (a.config_element != nil && key == a.config_element.Key) {
+			return fmt.Errorf("config file %s: unknown key: %s", filename, key[2:])
+		}
+	}
+	a.Config_file = filename
+	a.config = config
+	return nil
+}
+
+// fill_config fills the options of the config file which are not elements.
+func (a *Annotated_usage) fill_config(args docopt.Opts) error {
+	for key, value := range a.config {
+		if _, found := a.sources[key]; found {
+			continue
+		}
+		if !Is_missing(args[key]) {
+			a.sources[key] = "argv"
+			continue
+		}
+		filled, err := Config_value(args[key], value)
+		if err != nil {
+			return fmt.Errorf("%s: config file %s: %v", key, a.Config_file, err)
+		}
+		args[key] = filled
+		a.sources[key] = "config " + a.Config_file
+	}
+	return nil
+}
+
+// Config_value converts the values of a key to the type of the missing value,
+// as Fill_value().
+func Config_value(missing interface{}, values []string) (interface{}, error) {
+	if _, is_array := missing.([]string); is_array {
+		return values, nil
+	}
+	if len(values) != 1 {
+		return nil, fmt.Errorf("a single value is expected, got: %d", len(values))
+	}
+	return Fill_value(missing, values[0])
+}
+
+// Expand_home replaces a leading ~/ by the home directory.
+func Expand_home(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[2:])
+}
+
+// expand_home is Expand_home() with the home directory of a.Env, if any.
+func (a *Annotated_usage) expand_home(path string) string {
+	if a.Env == nil || !strings.HasPrefix(path, "~/") {
+		return Expand_home(path)
+	}
+	if home := a.Env["HOME"]; home != "" {
+		return filepath.Join(home, path[2:])
+	}
+	return path
+}
+
+// Load_config reads a config file, its format is given by its extension:
+// .json, .toml, else INI.
+func Load_config(filename string) (Config, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		return Parse_json_config(content)
+	case ".toml":
+		return Parse_toml_config(string(content))
+	}
+	return Parse_ini_config(string(content))
+}
+
+// Parse_json_config reads an object of scalars or arrays of scalars, null
+// values are ignored.
+func Parse_json_config(content []byte) (Config, error) {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	values := make(map[string]interface{})
+	if err := decoder.Decode(&values); err != nil {
+		return nil, err
+	}
+
+	config := make(Config)
+	for key, value := range values {
+		list, is_list := value.([]interface{})
+		if !is_list {
+			if value == nil {
+				continue
+			}
+			list = []interface{}{value}
+		}
+		config["--"+key] = []string{}
+		for _, v := range list {
+			switch v.(type) {
+			case string, json.Number, bool:
+				config["--"+key] = append(config["--"+key], fmt.Sprintf("%v", v))
+			default:
+				return nil, fmt.Errorf("%s: only scalars and arrays of scalars are supported", key)
+			}
+		}
+	}
+	return config, nil
+}
+
+// Parse_toml_config reads the key = value lines of a TOML file: strings,
+// numbers, booleans and one line arrays of them. Tables are not supported.
+func Parse_toml_config(content string) (Config, error) {
+	config := make(Config)
+	for n, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(strip_toml_comment(line))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			return nil, fmt.Errorf("line %d: tables are not supported: %s", n+1, line)
+		}
+		key, eq, value := string_partition(line, "=")
+		key = strings.Trim(strings.TrimSpace(key), `"'`)
+		if eq == "" || key == "" {
+			return nil, fmt.Errorf("line %d: key = value expected: %s", n+1, line)
+		}
+		if _, found := config["--"+key]; found {
+			return nil, fmt.Errorf("line %d: duplicate key: %s", n+1, key)
+		}
+		values, err := parse_toml_value(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n+1, err)
+		}
+		config["--"+key] = values
+	}
+	return config, nil
+}
+
+func parse_toml_value(value string) ([]string, error) {
+	if !strings.HasPrefix(value, "[") {
+		v, err := parse_toml_scalar(value)
+		return []string{v}, err
+	}
+	if !strings.HasSuffix(value, "]") {
+		return nil, fmt.Errorf("only one line arrays are supported: %s", value)
+	}
+	values := []string{}
+	for _, item := range split_quoted(value[1:len(value)-1], ',') {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		v, err := parse_toml_scalar(item)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+func parse_toml_scalar(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		return strconv.Unquote(value)
+	case strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'") && len(value) > 1:
+		return value[1 : len(value)-1], nil
+	case value == "true" || value == "false":
+		return value, nil
+	}
+	number := strings.Replace(value, "_", "", -1)
+	if _, err := strconv.ParseFloat(number, 64); err != nil {
+		return "", fmt.Errorf("invalid value: %s", value)
+	}
+	return number, nil
+}
+
+// strip_toml_comment removes a # comment outside of quotes.
+func strip_toml_comment(line string) string {
+	return split_quoted(line, '#')[0]
+}
+
+// split_quoted splits s at sep outside of single or double quotes.
+func split_quoted(s string, sep byte) []string {
+	parts := []string{}
+	quote := byte(0)
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quote == '"' && s[i] == '\\':
+			i++
+		case quote != 0:
+			if s[i] == quote {
+				quote = 0
+			}
+		case s[i] == '"' || s[i] == '\'':
+			quote = s[i]
+		case s[i] == sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// Parse_ini_config reads key = value or key: value lines, ; and # start a
+// comment line. A key repeated gives many values. Sections are not supported.
+func Parse_ini_config(content string) (Config, error) {
+	config := make(Config)
+	for n, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			return nil, fmt.Errorf("line %d: sections are not supported: %s", n+1, line)
+		}
+		i := strings.IndexAny(line, "=:")
+		if i <= 0 {
+			return nil, fmt.Errorf("line %d: key = value expected: %s", n+1, line)
+		}
+		key := strings.TrimSpace(line[:i])
+		value := strings.TrimSpace(line[i+1:])
+		if len(value) > 1 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		config["--"+key] = append(config["--"+key], value)
+	}
+	return config, nil
+}
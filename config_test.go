@@ -0,0 +1,169 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// unit test for config.go
+//
+package main
+
+import (
+	"github.com/docopt/docopt-go"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParse_config(t *testing.T) {
+	tables := []struct {
+		format     string
+		content    string
+		expect     Config
+		expect_err bool
+	}{
+		{"json", `{"speed": 10, "name": "a b", "tag": ["x", 2], "dry-run": true, "none": null}`,
+			Config{"--speed": {"10"}, "--name": {"a b"}, "--tag": {"x", "2"}, "--dry-run": {"true"}}, false},
+		{"json", `{"nested": {"a": 1}}`, nil, true},
+		{"json", `[1, 2]`, nil, true},
+		{"toml", "# comment\nspeed = 1_000 # knots\nname = \"a \\\"b\\\"\"\npath = 'c:\\dir'\ntag = [\"x\", 'y#', 3]\ndry-run = true\n",
+			Config{"--speed": {"1000"}, "--name": {`a "b"`}, "--path": {`c:\dir`}, "--tag": {"x", "y#", "3"}, "--dry-run": {"true"}}, false},
+		{"toml", "[table]\nspeed = 1", nil, true},
+		{"toml", "speed = fast", nil, true},
+		{"toml", "speed = 1\nspeed = 2", nil, true},
+		{"toml", "tag = [\n  \"x\",\n]", nil, true},
+		{"ini", "; comment\n# comment\nspeed = 10\nname: \"a b\"\ntag = x\ntag = y\n",
+			Config{"--speed": {"10"}, "--name": {"a b"}, "--tag": {"x", "y"}}, false},
+		{"ini", "[section]\nspeed = 1", nil, true},
+		{"ini", "speed", nil, true},
+	}
+	for _, table := range tables {
+		var got Config
+		var err error
+		switch table.format {
+		case "json":
+			got, err = Parse_json_config([]byte(table.content))
+		case "toml":
+			got, err = Parse_toml_config(table.content)
+		default:
+			got, err = Parse_ini_config(table.content)
+		}
+		if (err != nil) != table.expect_err {
+			t.Errorf("Parse %s config %q: got error %v, want error: %v", table.format, table.content, err, table.expect_err)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(got, table.expect) {
+			t.Errorf("Parse %s config %q: got %v, want %v", table.format, table.content, got, table.expect)
+		}
+	}
+}
+
+func TestAnnotated_usage_config(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docopts-config-")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	default_file := filepath.Join(dir, "default.ini")
+	other_file := filepath.Join(dir, "other.json")
+	ioutil.WriteFile(other_file, []byte(`{"speed": 9, "tag": ["x"], "verbose": true}`), 0644)
+
+	doc := `Usage: prog [--conf=<f>] [--speed=<s>] [--tag=<t>...] [-v]
+
+Options:
+  --conf=<f>     Config file [config: ` + default_file + `]
+  --speed=<s>    Speed [default: 1] [type: int]
+  --tag=<t>      Tags
+  -v, --verbose  Verbose`
+	missing := func() docopt.Opts {
+		return docopt.Opts{"--conf": nil, "--speed": nil, "--tag": []string{}, "--verbose": false}
+	}
+	tables := []struct {
+		default_content string
+		args            docopt.Opts
+		expect          docopt.Opts
+		expect_err      bool
+	}{
+		// no config file: the default applies
+		{"", missing(), docopt.Opts{"--conf": nil, "--speed": 1, "--tag": []string{}, "--verbose": false}, false},
+		{"speed = 5\ntag = a\n", missing(),
+			docopt.Opts{"--conf": nil, "--speed": 5, "--tag": []string{"a"}, "--verbose": false}, false},
+		// argv > config, even if the value given is the default
+		{"speed = 5\n", docopt.Opts{"--conf": nil, "--speed": "1", "--tag": []string{}, "--verbose": false},
+			docopt.Opts{"--conf": nil, "--speed": 1, "--tag": []string{}, "--verbose": false}, false},
+		{"", docopt.Opts{"--conf": other_file, "--speed": nil, "--tag": []string{}, "--verbose": false},
+			docopt.Opts{"--conf": other_file, "--speed": 9, "--tag": []string{"x"}, "--verbose": true}, false},
+		{"unknown = 1\n", missing(), nil, true},
+		{"speed = 1\nspeed = 2\n", missing(), nil, true},
+		{"", docopt.Opts{"--conf": filepath.Join(dir, "not_found.ini"), "--speed": nil, "--tag": []string{}, "--verbose": false}, nil, true},
+	}
+	for _, table := range tables {
+		os.Remove(default_file)
+		if table.default_content != "" {
+			ioutil.WriteFile(default_file, []byte(table.default_content), 0644)
+		}
+		a, err := Parse_annotations(doc)
+		if err != nil {
+			t.Fatalf("Parse_annotations: %v", err)
+		}
+		err = a.Apply(table.args)
+		if (err != nil) != table.expect_err {
+			t.Errorf("Apply() config %q: got error %v, want error: %v", table.default_content, err, table.expect_err)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(table.args, table.expect) {
+			t.Errorf("Apply() config %q: got %v, want %v", table.default_content, table.args, table.expect)
+		}
+	}
+}
+
+func TestAnnotated_usage_config_client(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docopts-config-")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "home.ini"), []byte("speed = 2\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "other.ini"), []byte("speed = 3\n"), 0644)
+
+	// a server reads the files of its client: ~/ is its HOME, a relative
+	// path is relative to its current directory
+	doc := `Usage: prog [--conf=<f>] [--speed=<s>]
+
+Options:
+  --conf=<f>   Config file [config: ~/home.ini]
+  --speed=<s>  Speed [default: 1]`
+	tables := []struct {
+		conf   interface{}
+		expect string
+	}{
+		{nil, "2"},
+		{"other.ini", "3"},
+	}
+	for _, table := range tables {
+		a, err := Parse_annotations(doc)
+		if err != nil {
+			t.Fatalf("Parse_annotations: %v", err)
+		}
+		a.Env = map[string]string{"HOME": dir}
+		a.Dir = dir
+		args := docopt.Opts{"--conf": table.conf, "--speed": nil}
+		if err = a.Apply(args); err != nil || args["--speed"] != table.expect {
+			t.Errorf("Apply() --conf %v: got %v %v, want --speed %s", table.conf, args, err, table.expect)
+		}
+	}
+}
+
+func TestRemove_defaults(t *testing.T) {
+	doc := "Usage: prog [--speed=<s>] [--name=<n>]\n\nOptions:\n  --speed=<s>  Speed [default: 1]\n  --name=<n>  Name"
+	a, err := Parse_annotations(doc)
+	if err != nil {
+		t.Fatalf("Parse_annotations: %v", err)
+	}
+	a.Remove_defaults()
+	expect := "Usage: prog [--speed=<s>] [--name=<n>]\n\nOptions:\n  --speed=<s>  Speed \n  --name=<n>  Name"
+	if a.Doc != expect {
+		t.Errorf("Remove_defaults(): got %q, want %q", a.Doc, expect)
+	}
+	if len(a.Elements) != 1 || a.Elements[0].Key != "--speed" {
+		t.Errorf("Remove_defaults(): got elements %v, want --speed", a.Elements)
+	}
+}
@@ -0,0 +1,131 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// constraints.go reads the optional Constraints: section of a usage, between
+// elements given together:
+//
+//	Constraints:
+//	  --cert requires --key
+//	  --json conflicts --color
+//
+// The constraints are checked once docopt has parsed argv, before the
+// annotations of Phase_check.
+//
+package main
+
+import (
+	"fmt"
+	"github.com/docopt/docopt-go"
+	"regexp"
+	"strings"
+)
+
+// a Constraints: header starts a line, unlike docopt's sections: the word
+// can be found in the description of an option
+var re_constraints_section = regexp.MustCompile(`(?im)^(constraints:[^\n]*\n?(?:[ \t].*?(?:\n|$))*)`)
+
+func init() {
+	Register_syntax("constraints")
+}
+
+type Constraint struct {
+	Key string
+	// requires or conflicts
+	Kind string
+	// the elements required by Key, or conflicting with it
+	Others []string
+}
+
+func (c *Constraint) String() string {
+	return c.Key + " " + c.Kind + " " + strings.Join(c.Others, " ")
+}
+
+// Parse_constraints reads the lines of the Constraints: sections of doc, whose
+// header starts a line: <element> requires|conflicts <element>... Options are
+// named as in the usage, their key is the one docopt gives. The elements are
+// checked against m, if not nil.
+func Parse_constraints(doc string, m *Usage_model) ([]*Constraint, error) {
+	constraints := []*Constraint{}
+	for _, section := range re_constraints_section.FindAllString(doc, -1) {
+		_, _, section = string_partition(section, ":")
+		for _, line := range strings.Split(section, "\n") {
+			words := strings.Fields(line)
+			if len(words) == 0 {
+				continue
+			}
+			if len(words) < 3 || (words[1] != "requires" && words[1] != "conflicts") {
+				return nil, fmt.Errorf("constraint: '%s', expected: <element> requires|conflicts <element>...",
+					strings.TrimSpace(line))
+			}
+			c := &Constraint{Kind: words[1]}
+			for i, name := range append(words[:1], words[2:]...) {
+				key, err := constraint_key(name, m)
+				if err != nil {
+					return nil, fmt.Errorf("constraint: '%s': %v", strings.TrimSpace(line), err)
+				}
+				if i == 0 {
+					c.Key = key
+				} else {
+					c.Others = append(c.Others, key)
+				}
+			}
+			constraints = append(constraints, c)
+		}
+	}
+	return constraints, nil
+}
+
+// constraint_key returns the key of the element name in m: the long name of
+// an option given by its short name.
+func constraint_key(name string, m *Usage_model) (string, error) {
+	if m == nil {
+		return name, nil
+	}
+	if o := m.Find_option(name); o != nil {
+		name = o.Name()
+	}
+	if !string_set(m.Leaves())[name] {
+		return "", fmt.Errorf("%s not found in usage", name)
+	}
+	return name, nil
+}
+
+// Check_constraints returns an error for the first constraint violated by
+// args.
+func (a *Annotated_usage) Check_constraints(args docopt.Opts) error {
+	for _, c := range a.constraints {
+		if !a.is_given(c.Key, args) {
+			continue
+		}
+		for _, other := range c.Others {
+			given := a.is_given(other, args)
+			if c.Kind == "requires" && !given {
+				return fmt.Errorf("%s requires %s", c.Key, other)
+			}
+			if c.Kind == "conflicts" && given {
+				return fmt.Errorf("%s conflicts with %s", c.Key, other)
+			}
+		}
+	}
+	return nil
+}
+
+// is_given tells if an element is given: on argv, or by another source than
+// its default. An option is given if found on argv, whatever its value: the
+// default docopt gives to an option not found is not given.
+func (a *Annotated_usage) is_given(key string, args docopt.Opts) bool {
+	if source, filled := a.sources[key]; filled {
+		return source != "default" && source != "not given"
+	}
+	if Is_missing(args[key]) {
+		return false
+	}
+	if a.model == nil || a.Argv == nil || a.model.Find_option(key) == nil {
+		return true
+	}
+	// docopt gives the default of an option not given
+	given := false
+	a.scan_options(a.Argv, func(i int, k string, attached bool) {
+		given = given || k == key
+	})
+	return given
+}
@@ -0,0 +1,104 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// unit test for constraints.go
+//
+package main
+
+import (
+	"github.com/docopt/docopts/docopt_engine"
+	"strings"
+	"testing"
+)
+
+func TestParse_constraints(t *testing.T) {
+	tables := []struct {
+		constraints string
+		expect      string
+		expect_err  bool
+	}{
+		{"  --cert requires --key\n  --json conflicts --color <file>", "--cert requires --key,--json conflicts --color <file>", false},
+		{"  -c requires -k", "--cert requires -k", false},
+		{"  --cert needs --key", "", true},
+		{"  --cert requires", "", true},
+		{"  --cert requires --kex", "", true},
+	}
+	for _, table := range tables {
+		doc := "Usage: prog [-c=<c>] [-k] [--key=<k>] [--json] [--color=<w>] [<file>]\n\n" +
+			"Options:\n  -c, --cert=<c>  Cert\n\nConstraints:\n" + table.constraints
+		model, err := Parse_usage(doc)
+		if err != nil {
+			t.Fatalf("Parse_usage: %v", err)
+		}
+		constraints, err := Parse_constraints(doc, model)
+		if (err != nil) != table.expect_err {
+			t.Errorf("Parse_constraints(%q): got error %v, want error: %v", table.constraints, err, table.expect_err)
+			continue
+		}
+		got := []string{}
+		for _, c := range constraints {
+			got = append(got, c.String())
+		}
+		if err == nil && strings.Join(got, ",") != table.expect {
+			t.Errorf("Parse_constraints(%q): got %q, want %q", table.constraints, strings.Join(got, ","), table.expect)
+		}
+	}
+}
+
+func TestParse_constraints_in_description(t *testing.T) {
+	// not a Constraints: section, a valid docopt usage
+	doc := `Usage: prog [options]
+
+Options:
+  --strict  Check the constraints: fail on a warning.
+  --level=<n>  Level
+    constraints: none`
+	a, err := Parse_annotations(doc)
+	if err != nil {
+		t.Fatalf("Parse_annotations(%q): %v", doc, err)
+	}
+	if len(a.constraints) != 0 {
+		t.Errorf("Parse_annotations(%q): got constraints %v", doc, a.constraints)
+	}
+}
+
+func TestCheck_constraints(t *testing.T) {
+	doc := `Usage: prog [--cert=<c>] [--key=<k>] [--json] [--color=<when>]
+
+Options:
+  --color=<when>  Color [default: auto]
+
+Constraints:
+  --cert requires --key
+  --json conflicts --color`
+	tables := []struct {
+		argv       []string
+		expect_err string
+	}{
+		{[]string{"--cert=c", "--key=k", "--json"}, ""},
+		{[]string{"--color=never"}, ""},
+		{[]string{"--cert=c"}, "--cert requires --key"},
+		{[]string{"--json", "--color=never"}, "--json conflicts with --color"},
+		// the default given on argv is given
+		{[]string{"--json", "--col", "auto"}, "--json conflicts with --color"},
+		{[]string{"--cert", "--color", "--key=k", "--json"}, ""},
+	}
+	a, err := Parse_annotations(doc)
+	if err != nil {
+		t.Fatalf("Parse_annotations: %v", err)
+	}
+	parser := &docopt_engine.Parser{HelpHandler: docopt_engine.NoHelpHandler}
+	for _, table := range tables {
+		args, err := parser.ParseDoc(a.Doc, a.Prepare_argv(table.argv, false), "")
+		if err != nil {
+			t.Fatalf("ParseArgs(%q): %v", table.argv, err)
+		}
+		err = a.Apply(args)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != table.expect_err {
+			t.Errorf("Apply(%q): got error %q, want %q", table.argv, got, table.expect_err)
+		}
+	}
+}
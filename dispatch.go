@@ -0,0 +1,76 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// dispatch.go outputs the call to the function of the selected commands, for
+// git-style scripts: docopts --dispatch <prefix>
+//
+package main
+
+import (
+	"fmt"
+	"github.com/docopt/docopt-go"
+	"strings"
+)
+
+func init() {
+	Register_flag("--dispatch")
+}
+
+// Selected_commands returns the longest command path of the usage which
+// commands are all given in args, or an empty path.
+func Selected_commands(m *Usage_model, args docopt.Opts) []string {
+	for _, path := range m.Command_paths() {
+		selected := true
+		for _, command := range path {
+			switch v := args[command].(type) {
+			case bool:
+				selected = selected && v
+			case int:
+				selected = selected && v > 0
+			default:
+				selected = false
+			}
+		}
+		if selected {
+			return path
+		}
+	}
+	return []string{}
+}
+
+// Dispatch_function returns the function name: prefix followed by the
+// commands joined by '_', dashes are replaced by '_' too.
+func Dispatch_function(prefix string, path []string) (string, error) {
+	name := prefix + strings.Replace(strings.Join(path, "_"), "-", "_", -1)
+	if !IsBashIdentifier(name) {
+		return "", fmt.Errorf("cannot transform into a bash function name: '%s' => '%s'",
+			strings.Join(path, " "), name)
+	}
+	return name, nil
+}
+
+// Print_dispatch outputs the array docopt_command of the selected commands
+// and the call to their function with the script's arguments. A missing
+// function is reported as an error at run time, exit code 70.
+func (d *Docopts) Print_dispatch(prefix string, m *Usage_model, args docopt.Opts) error {
+	path := Selected_commands(m, args)
+
+	quoted := make([]string, len(path))
+	for i, command := range path {
+		quoted[i] = To_bash(command)
+	}
+	fmt.Fprintf(d.output(), "docopt_command=(%s)\n", strings.Join(quoted, " "))
+	if len(path) == 0 {
+		// no command given, nothing to call
+		return nil
+	}
+
+	function, err := Dispatch_function(prefix, path)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(d.output(), "if ! declare -F %s > /dev/null ; then\n", function)
+	fmt.Fprintf(d.output(), "echo 'error: function %s not found for command: %s' >&2\n%s\nfi\n",
+		function, Shellquote(strings.Join(path, " ")), d.Get_exit_code(70))
+	fmt.Fprintf(d.output(), "%s \"$@\"\n", function)
+	return nil
+}
@@ -0,0 +1,107 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// unit test for dispatch.go
+//
+package main
+
+import (
+	"bytes"
+	"github.com/docopt/docopt-go"
+	"github.com/docopt/docopts/docopt_engine"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var git_style = `Usage:
+  prog remote add <name> <url>
+  prog remote [-v]
+  prog remote-show <name>
+  prog (-h | --help)`
+
+func TestSelected_commands(t *testing.T) {
+	m, err := Parse_usage(git_style)
+	if err != nil {
+		t.Fatalf("Parse_usage error: %v", err)
+	}
+	tables := []struct {
+		argv   []string
+		expect []string
+	}{
+		{[]string{"remote", "add", "origin", "url"}, []string{"remote", "add"}},
+		{[]string{"remote", "-v"}, []string{"remote"}},
+		{[]string{"remote-show", "origin"}, []string{"remote-show"}},
+		{[]string{"--help"}, []string{}},
+	}
+	parser := &docopt_engine.Parser{HelpHandler: docopt_engine.NoHelpHandler, SkipHelpFlags: true}
+	for _, table := range tables {
+		args, err := parser.ParseDoc(git_style, table.argv, "")
+		if err != nil {
+			t.Fatalf("ParseArgs %v error: %v", table.argv, err)
+		}
+		path := Selected_commands(m, args)
+		if !reflect.DeepEqual(path, table.expect) {
+			t.Errorf("Selected_commands %v got: %v, want: %v", table.argv, path, table.expect)
+		}
+	}
+
+	// repeated command is a counter
+	m, _ = Parse_usage("Usage: prog go...")
+	path := Selected_commands(m, docopt.Opts{"go": 2})
+	if !reflect.DeepEqual(path, []string{"go"}) {
+		t.Errorf("Selected_commands counter got: %v", path)
+	}
+}
+
+func TestDispatch_function(t *testing.T) {
+	tables := []struct {
+		prefix string
+		path   []string
+		expect string
+	}{
+		{"cmd_", []string{"remote", "add"}, "cmd_remote_add"},
+		{"cmd_", []string{"remote-show"}, "cmd_remote_show"},
+		{"", []string{"build"}, "build"},
+	}
+	for _, table := range tables {
+		name, err := Dispatch_function(table.prefix, table.path)
+		if err != nil || name != table.expect {
+			t.Errorf("Dispatch_function %v got: '%s' %v, want: '%s'", table.path, name, err, table.expect)
+		}
+	}
+	if _, err := Dispatch_function("cmd_", []string{"a.b"}); err == nil {
+		t.Errorf("Dispatch_function expecting error on invalid function name")
+	}
+}
+
+func TestPrint_dispatch(t *testing.T) {
+	var buf bytes.Buffer
+	d := &Docopts{Output: &buf}
+	m, err := Parse_usage(git_style)
+	if err != nil {
+		t.Fatalf("Parse_usage error: %v", err)
+	}
+
+	err = d.Print_dispatch("cmd_", m, docopt.Opts{"remote": true, "add": true, "remote-show": false})
+	res := buf.String()
+	expect := []string{
+		"docopt_command=('remote' 'add')\n",
+		"if ! declare -F cmd_remote_add > /dev/null ; then\n",
+		"echo 'error: function cmd_remote_add not found for command: remote add' >&2\nexit 70\nfi\n",
+		"cmd_remote_add \"$@\"\n",
+	}
+	if err != nil || res != strings.Join(expect, "") {
+		t.Errorf("Print_dispatch got: '%s', err: %v", res, err)
+	}
+
+	buf.Reset()
+	err = d.Print_dispatch("cmd_", m, docopt.Opts{"remote": false, "add": false, "remote-show": false})
+	if err != nil || buf.String() != "docopt_command=()\n" {
+		t.Errorf("Print_dispatch without command got: '%s', err: %v", buf.String(), err)
+	}
+
+	err = d.Print_dispatch("1cmd_", m, docopt.Opts{"remote": true, "add": false})
+	if err == nil {
+		t.Errorf("Print_dispatch expecting error on invalid prefix")
+	}
+}
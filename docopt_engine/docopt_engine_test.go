@@ -0,0 +1,217 @@
+// unit test for docopt_engine: results are compared to docopt-go
+package docopt_engine
+
+import (
+	"github.com/docopt/docopt-go"
+	"io/ioutil"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+type testcase struct {
+	doc   string
+	argvs [][]string
+}
+
+// load_testcases reads docopt usages and argv from testcases.docopt, expected
+// results are ignored as they are given by docopt-go.
+func load_testcases(t *testing.T, filename string) []testcase {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("cannot read %s: %v", filename, err)
+	}
+	fixtures := regexp.MustCompile(`(?m)#.*$`).ReplaceAllString(string(content), "")
+
+	cases := []testcase{}
+	for _, fixture := range strings.Split(fixtures, `r"""`)[1:] {
+		parts := strings.SplitN(fixture, `"""`, 2)
+		c := testcase{doc: parts[0]}
+		for _, line := range strings.Split(parts[1], "\n") {
+			if strings.HasPrefix(line, "$ ") {
+				c.argvs = append(c.argvs, strings.Fields(line)[1:])
+			}
+		}
+		cases = append(cases, c)
+	}
+	return cases
+}
+
+func TestParseArgs(t *testing.T) {
+	cases := load_testcases(t, "../testcases.docopt")
+	if len(cases) < 80 {
+		t.Fatalf("testcases.docopt: only %d cases loaded", len(cases))
+	}
+
+	for _, table := range []struct {
+		help          bool
+		options_first bool
+		version       string
+	}{
+		{true, false, ""},
+		{false, false, ""},
+		{true, true, "1.0"},
+	} {
+		upstream := &docopt.Parser{
+			HelpHandler:   docopt.NoHelpHandler,
+			OptionsFirst:  table.options_first,
+			SkipHelpFlags: !table.help,
+		}
+		parser := &Parser{
+			OptionsFirst:  table.options_first,
+			SkipHelpFlags: !table.help,
+		}
+
+		for _, c := range cases {
+			u, err := Compile(c.doc)
+			_, expected_err := upstream.ParseArgs(c.doc, []string{}, table.version)
+			if _, language_error := expected_err.(*docopt.LanguageError); language_error {
+				if _, ok := err.(*LanguageError); !ok {
+					t.Errorf("Compile: LanguageError expected, got: %v\n%s", err, c.doc)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("Compile error: %v\n%s", err, c.doc)
+				continue
+			}
+
+			// also decoded, as stored on disk
+			data, err := u.MarshalBinary()
+			if err != nil {
+				t.Errorf("MarshalBinary error: %v\n%s", err, c.doc)
+				continue
+			}
+			decoded := &Usage{}
+			if err = decoded.UnmarshalBinary(data); err != nil {
+				t.Errorf("UnmarshalBinary error: %v\n%s", err, c.doc)
+				continue
+			}
+
+			// run twice, the compiled usage must not keep any state
+			for _, u := range []*Usage{u, u, decoded, decoded} {
+				for _, argv := range c.argvs {
+					expected, expected_err := upstream.ParseArgs(c.doc, argv, table.version)
+					args, err := parser.ParseArgs(u, argv, table.version)
+					if (expected_err == nil) != (err == nil) {
+						t.Errorf("ParseArgs %v: error: %v, docopt-go error: %v\n%s", argv, err, expected_err, c.doc)
+						continue
+					}
+					if err != nil && err.Error() != expected_err.Error() {
+						t.Errorf("ParseArgs %v: error: %v, docopt-go error: %v\n%s", argv, err, expected_err, c.doc)
+					}
+					if !reflect.DeepEqual(map[string]interface{}(expected), args) {
+						t.Errorf("ParseArgs %v: got: %v, docopt-go: %v\n%s", argv, args, expected, c.doc)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestParseArgs_HelpHandler(t *testing.T) {
+	doc := "Usage: prog [--help] [--version] <file>"
+	u, err := Compile(doc)
+	if err != nil {
+		t.Fatalf("Compile error: %v", err)
+	}
+
+	var got_err error
+	var got_usage string
+	parser := &Parser{HelpHandler: func(err error, usage string) {
+		got_err, got_usage = err, usage
+	}}
+
+	tables := []struct {
+		argv     []string
+		user_err bool
+		usage    string
+	}{
+		{[]string{"--help"}, false, doc},
+		{[]string{"--version"}, false, "1.0"},
+		{[]string{}, true, "Usage: prog [--help] [--version] <file>"},
+		{[]string{"a", "b"}, true, "Usage: prog [--help] [--version] <file>"},
+	}
+	for _, table := range tables {
+		got_err, got_usage = nil, ""
+		args, err := parser.ParseArgs(u, table.argv, "1.0")
+		if args != nil {
+			t.Errorf("ParseArgs %v: no args expected, got: %v", table.argv, args)
+		}
+		if _, ok := err.(*UserError); ok != table.user_err || got_err != err {
+			t.Errorf("ParseArgs %v: error: %v, HelpHandler error: %v", table.argv, err, got_err)
+		}
+		if got_usage != table.usage {
+			t.Errorf("ParseArgs %v: HelpHandler usage: '%s', want: '%s'", table.argv, got_usage, table.usage)
+		}
+	}
+}
+
+func TestUnmarshalBinary(t *testing.T) {
+	u, err := Compile("Usage: prog [-v...] <file>...")
+	if err != nil {
+		t.Fatalf("Compile error: %v", err)
+	}
+	data, err := u.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary error: %v", err)
+	}
+	decoded := &Usage{}
+	if err := decoded.UnmarshalBinary(data); err != nil || decoded.Doc() != u.Doc() {
+		t.Errorf("UnmarshalBinary error: %v, doc: '%s'", err, decoded.Doc())
+	}
+
+	tables := []string{
+		"",
+		"{}",
+		`{"Format": 0, "Pattern": {"T": 8}}`,
+		`{"Format": 1}`,
+		`{"Format": 1, "Pattern": {"T": 0}}`,
+		`{"Format": 1, "Pattern": {"T": 8, "Children": [{"T": 1, "Kind": "float"}]}}`,
+		strings.Replace(string(data), `"Format":1`, `"Format":999`, 1),
+	}
+	for _, table := range tables {
+		if err := (&Usage{}).UnmarshalBinary([]byte(table)); err == nil {
+			t.Errorf("UnmarshalBinary '%s': expecting error", table)
+		}
+	}
+}
+
+func TestPattern(t *testing.T) {
+	u, err := Compile("Usage: prog [options] -v... <file>...\n  prog go\n\nOptions:\n  -q  Quiet.\n")
+	if err != nil {
+		t.Fatalf("Compile error: %v", err)
+	}
+
+	root := u.Pattern()
+	if root.Type != "required" || len(root.Children) != 1 || root.Children[0].Type != "either" {
+		t.Fatalf("Pattern root: %+v", root)
+	}
+	lines := root.Children[0].Children
+	if len(lines) != 2 || lines[0].Type != "required" || lines[1].Children[0].Name != "go" {
+		t.Fatalf("Pattern lines: %+v", lines)
+	}
+	shortcut := lines[0].Children[0].Children[0]
+	if shortcut.Type != "optionsshortcut" || len(shortcut.Children) != 1 || shortcut.Children[0].Name != "-q" {
+		t.Errorf("Pattern options shortcut: %+v", shortcut)
+	}
+	if v := lines[0].Children[1].Children[0]; v.Name != "-v" || v.Value != 0 {
+		t.Errorf("Pattern repeated -v: %+v", v)
+	}
+
+	// the copy doesn't change u
+	file := lines[0].Children[2].Children[0]
+	file.Value = append(file.Value.([]string), "changed")
+	if v := u.Pattern().Children[0].Children[0].Children[2].Children[0].Value; !reflect.DeepEqual(v, []string{}) {
+		t.Errorf("Pattern <file> value changed: %v", v)
+	}
+
+	names := []string{}
+	for _, o := range u.Options() {
+		names = append(names, o.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"-q", "-v"}) {
+		t.Errorf("Options got: %v", names)
+	}
+}
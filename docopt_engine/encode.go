@@ -0,0 +1,151 @@
+// Licensed under terms of MIT license (see LICENSE-MIT)
+//
+// encode.go serializes a compiled Usage, so it can be stored on disk.
+package docopt_engine
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Format of the serialized Usage, to be changed with the Usage or pattern
+// structures, so older serialized data is refused.
+const Format = 1
+
+type encoded_usage struct {
+	Format  int
+	Doc     string
+	Usage   string
+	Pattern *encoded_pattern
+	Options []*encoded_pattern
+}
+
+// pattern with its value typed as: bool, int, string, list or nil (empty)
+type encoded_pattern struct {
+	T        patternType
+	Children []*encoded_pattern `json:",omitempty"`
+	Name     string             `json:",omitempty"`
+	Short    string             `json:",omitempty"`
+	Long     string             `json:",omitempty"`
+	Argcount int                `json:",omitempty"`
+	Kind     string             `json:",omitempty"`
+	Bool     bool               `json:",omitempty"`
+	Int      int                `json:",omitempty"`
+	String   string             `json:",omitempty"`
+	List     []string           `json:",omitempty"`
+}
+
+// Doc returns the usage message u was compiled from.
+func (u *Usage) Doc() string {
+	return u.doc
+}
+
+// MarshalBinary encodes the compiled usage u.
+func (u *Usage) MarshalBinary() ([]byte, error) {
+	e := &encoded_usage{
+		Format:  Format,
+		Doc:     u.doc,
+		Usage:   u.usage,
+		Pattern: encode_pattern(u.pat),
+	}
+	for _, o := range u.options {
+		e.Options = append(e.Options, encode_pattern(o))
+	}
+	return json.Marshal(e)
+}
+
+// UnmarshalBinary decodes a compiled usage encoded by MarshalBinary.
+func (u *Usage) UnmarshalBinary(data []byte) error {
+	e := &encoded_usage{}
+	err := json.Unmarshal(data, e)
+	if err != nil {
+		return err
+	}
+	if e.Format != Format {
+		return fmt.Errorf("unsupported format: %d", e.Format)
+	}
+	if e.Pattern == nil {
+		return fmt.Errorf("pattern not found")
+	}
+
+	u.doc = e.Doc
+	u.usage = e.Usage
+	if u.pat, err = decode_pattern(e.Pattern); err != nil {
+		return err
+	}
+	u.options = patternList{}
+	for _, o := range e.Options {
+		p, err := decode_pattern(o)
+		if err != nil {
+			return err
+		}
+		u.options = append(u.options, p)
+	}
+	return nil
+}
+
+func encode_pattern(p *pattern) *encoded_pattern {
+	e := &encoded_pattern{
+		T:        p.t,
+		Name:     p.name,
+		Short:    p.short,
+		Long:     p.long,
+		Argcount: p.argcount,
+	}
+	switch v := p.value.(type) {
+	case bool:
+		e.Kind, e.Bool = "bool", v
+	case int:
+		e.Kind, e.Int = "int", v
+	case string:
+		e.Kind, e.String = "string", v
+	case []string:
+		e.Kind, e.List = "list", v
+	}
+	for _, c := range p.children {
+		e.Children = append(e.Children, encode_pattern(c))
+	}
+	return e
+}
+
+func decode_pattern(e *encoded_pattern) (*pattern, error) {
+	if e.T&patternAll == 0 {
+		return nil, fmt.Errorf("unknown pattern type: %d", e.T)
+	}
+	p := &pattern{
+		t:        e.T,
+		name:     e.Name,
+		short:    e.Short,
+		long:     e.Long,
+		argcount: e.Argcount,
+	}
+	switch e.Kind {
+	case "bool":
+		p.value = e.Bool
+	case "int":
+		p.value = e.Int
+	case "string":
+		p.value = e.String
+	case "list":
+		p.value = e.List
+		if e.List == nil {
+			p.value = []string{}
+		}
+	case "":
+		p.value = nil
+	default:
+		return nil, fmt.Errorf("unknown value kind: %s", e.Kind)
+	}
+	// branches always have a non nil list of children
+	if p.t&patternBranch != 0 {
+		p.children = patternList{}
+	}
+	for _, c := range e.Children {
+		child, err := decode_pattern(c)
+		if err != nil {
+			return nil, err
+		}
+		p.children = append(p.children, child)
+	}
+	return p, nil
+}
@@ -0,0 +1,56 @@
+// Licensed under terms of MIT license (see LICENSE-MIT)
+//
+// tree.go exposes a copy of a compiled Usage, for the tools which inspect a
+// usage message instead of parsing argv: docopts skeleton, fmt, diff...
+package docopt_engine
+
+// Node is a node of the compiled pattern tree. Type is one of: required,
+// optional, either, oneormore, optionsshortcut for a branch, argument, command,
+// option for a leaf. Name is the key of a leaf in the parsed arguments, Value
+// its value when not given: a leaf repeated in the usage has a []string or an
+// int value.
+type Node struct {
+	Type     string
+	Name     string
+	Short    string
+	Long     string
+	Argcount int
+	Value    interface{}
+	Children []*Node
+}
+
+// Pattern returns a copy of the pattern tree of u: a required node holding
+// either an either node of one required node per usage line, or the required
+// node of the only usage line. The options shortcut holds the options not
+// found elsewhere in the usage.
+func (u *Usage) Pattern() *Node {
+	return copy_node(u.pat)
+}
+
+// Options returns a copy of the options of u: those described in the options
+// sections, then those found only in the usage lines.
+func (u *Usage) Options() []*Node {
+	options := make([]*Node, len(u.options))
+	for i, o := range u.options {
+		options[i] = copy_node(o)
+	}
+	return options
+}
+
+func copy_node(p *pattern) *Node {
+	n := &Node{
+		Type:     p.t.String(),
+		Name:     p.name,
+		Short:    p.short,
+		Long:     p.long,
+		Argcount: p.argcount,
+		Value:    p.value,
+	}
+	if list, ok := p.value.([]string); ok {
+		n.Value = append([]string{}, list...)
+	}
+	for _, c := range p.children {
+		n.Children = append(n.Children, copy_node(c))
+	}
+	return n
+}
@@ -7,9 +7,11 @@ package main
 import (
 	"fmt"
 	"github.com/docopt/docopt-go"
+	"github.com/docopt/docopts/docopt_engine"
 	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
 	"regexp"
 	"sort"
@@ -72,6 +74,8 @@ Options:
                                   <prefix>_{mangled_args}={parsed_value}
                                 Can be used with numeric incompatible options
                                 as well.  See also: --no-mangle
+                                A [map] value is output as a global Bash 4.2+
+                                associative array: declare -gA.
   --no-mangle                   Output parsed option not suitable for bash eval.
                                 Full option names are kept. Rvalue is still
                                 shellquoted. Extra parsing is required.
@@ -79,17 +83,72 @@ Options:
                                 with -A argument.
   --debug                       Output extra parsing information for debugging.
                                 Output cannot be used in bash eval.
+  --dispatch=<prefix>           After the assignments, output the array
+                                docopt_command of the given commands, and a
+                                call to the function <prefix><command>_<sub>
+                                with the script's arguments: "$@".
+  --cache                       Keep the compiled usage message on disk, so the
+                                next runs don't parse it again.
+                                See: --cache-dir
+  --cache-dir=<dir>             Directory of the --cache, implies --cache. The
+                                default is $XDG_CACHE_HOME/docopts or
+                                ~/.cache/docopts
+  --connect=<socket>            Send the parse request to the docopts server
+                                listening on the unix <socket>, the output is
+                                the same. See: docopts serve --help
+  --config=<file>               Fill the options not given in <argv> from
+                                <file>, before their default: a JSON, TOML or
+                                INI file whose keys are long option names
+                                without the leading --.
+
+Verbs:
+  Each verb has its own help: docopts <verb> --help
+  skeleton                      Output a ready-to-edit script for a usage
+                                message.
+  diff                          Report breaking changes between two usage
+                                messages.
+  fmt                           Output a usage message in a canonical format.
+  test                          Check the examples of a usage message, report
+                                in TAP format.
+  serve                         Serve parse requests on a unix socket or on
+                                standard input.
+  exec                          Run a command with the parsed arguments
+                                exported as environment variables.
+  run                           Run a script with the arguments parsed from its
+                                usage header, as docopts-run.
+  lib                           Output the docopts.sh helper embedded in this
+                                docopts.
+  doctor                        Check the environment of docopts and
+                                docopts.sh.
+  version                       Output the version, --json with the
+                                capabilities of docopts.
 `
 
+// Verbs are docopts sub-commands, see API_proposal.md. They are dispatched
+// before the legacy -h <msg> parser and parse their own usage. Each verb
+// registers itself from an init() in its own source file.
+var verbs = map[string]func(argv []string) int{}
+
 // testing trick, out can be mocked to catch stdout and validate
 // https://stackoverflow.com/questions/34462355/how-to-deal-with-the-fmt-golang-library-package-for-cli-testing
 var out io.Writer = os.Stdout
 
 // debug helper
-func print_args(args docopt.Opts, message string) {
-	fmt.Printf("################## %s ##################\n", message)
+func print_args(w io.Writer, args docopt.Opts, message string) {
+	fmt.Fprintf(w, "################## %s ##################\n", message)
 	for _, key := range Sort_args_keys(args) {
-		fmt.Printf("%20s : %v\n", key, args[key])
+		fmt.Fprintf(w, "%20s : %v\n", key, args[key])
+	}
+}
+
+// debug helper: where the values filled by another source than argv come from
+func print_sources(w io.Writer, sources map[string]string) {
+	if len(sources) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "################## %s ##################\n", "sources")
+	for _, key := range sorted_names(sources) {
+		fmt.Fprintf(w, "%20s : %v\n", key, sources[key])
 	}
 }
 
@@ -110,6 +169,15 @@ type Docopts struct {
 	Mangle_key     bool
 	Output_declare bool
 	Exit_function  bool
+	// where bash code is output, nil is out
+	Output io.Writer
+}
+
+func (d *Docopts) output() io.Writer {
+	if d.Output != nil {
+		return d.Output
+	}
+	return out
 }
 
 // output bash 4+ compatible assoc array, suitable for eval.
@@ -122,7 +190,7 @@ func (d *Docopts) Print_bash_args(bash_assoc string, args docopt.Opts) {
 	// length can be 0, for empty array
 
 	if d.Output_declare {
-		fmt.Fprintf(out, "declare -A %s\n", bash_assoc)
+		fmt.Fprintf(d.output(), "declare -A %s\n", bash_assoc)
 	}
 
 	for _, key := range Sort_args_keys(args) {
@@ -133,13 +201,18 @@ func (d *Docopts) Print_bash_args(bash_assoc string, args docopt.Opts) {
 			// all array is outputed even 0 size
 			val_arr := value.([]string)
 			for index, v := range val_arr {
-				fmt.Fprintf(out, "%s['%s,%d']=%s\n", bash_assoc, Shellquote(key), index, To_bash(v))
+				fmt.Fprintf(d.output(), "%s['%s,%d']=%s\n", bash_assoc, Shellquote(key), index, To_bash(v))
 			}
 			// size of the array
-			fmt.Fprintf(out, "%s['%s,#']=%d\n", bash_assoc, Shellquote(key), len(val_arr))
+			fmt.Fprintf(d.output(), "%s['%s,#']=%d\n", bash_assoc, Shellquote(key), len(val_arr))
+		} else if m, is_map := value.(map[string]string); is_map {
+			// [map]: bash_assoc[key:k]=value
+			for _, k := range sorted_names(m) {
+				fmt.Fprintf(d.output(), "%s['%s:%s']=%s\n", bash_assoc, Shellquote(key), Shellquote(k), To_bash(m[k]))
+			}
 		} else {
 			// value is not an array
-			fmt.Fprintf(out, "%s['%s']=%s\n", bash_assoc, Shellquote(key), To_bash(value))
+			fmt.Fprintf(d.output(), "%s['%s']=%s\n", bash_assoc, Shellquote(key), To_bash(value))
 		}
 	}
 }
@@ -178,6 +251,8 @@ func To_bash(v interface{}) string {
 		s = fmt.Sprintf("%v", v.(bool))
 	case int:
 		s = fmt.Sprintf("%d", v.(int))
+	case float64:
+		s = To_string(v)
 	case string:
 		s = fmt.Sprintf("'%s'", Shellquote(v.(string)))
 	case []string:
@@ -193,6 +268,8 @@ func To_bash(v interface{}) string {
 			}
 			s = fmt.Sprintf("('%s')", strings.Join(arr_out[:], "' '"))
 		}
+	case map[string]string:
+		s = map_to_bash(v.(map[string]string))
 	case nil:
 		s = ""
 	default:
@@ -241,11 +318,16 @@ func (d *Docopts) Print_bash_global(args docopt.Opts) error {
 			varmap[new_name] = key
 		}
 
+		if _, is_map := args[key].(map[string]string); is_map {
+			// an associative array must be declared, global as the other
+			// variables when eval is run in a function: bash 4.2+
+			out_buf += "declare -gA "
+		}
 		out_buf += fmt.Sprintf("%s=%s\n", new_name, To_bash(args[key]))
 	}
 
 	// final output
-	fmt.Fprintf(out, "%s", out_buf)
+	fmt.Fprintf(d.output(), "%s", out_buf)
 
 	return nil
 }
@@ -302,30 +384,27 @@ func (d *Docopts) Get_exit_code(exit_code int) (str_code string) {
 	return
 }
 
-// Our HelpHandler which outputs bash source code to be evaled as error and stop or
-// display program's help or version.
-func (d *Docopts) HelpHandler_for_bash_eval(err error, usage string) {
+// Bash_eval_help returns the bash source code to be evaled as error and stop or
+// display program's help or version, and docopts's exit code.
+func (d *Docopts) Bash_eval_help(err error, usage string) (string, int) {
 	if err != nil {
-		fmt.Printf("echo 'error: %s\n%s' >&2\n%s\n",
+		return fmt.Sprintf("echo 'error: %s\n%s' >&2\n%s\n",
 			Shellquote(err.Error()),
 			Shellquote(usage),
 			d.Get_exit_code(64),
-		)
-		os.Exit(1)
-	} else {
-		// --help or --version found and --no-help was not given
-		fmt.Printf("echo '%s'\n%s\n", Shellquote(usage), d.Get_exit_code(0))
-		os.Exit(0)
+		), 1
 	}
+	// --help or --version found and --no-help was not given
+	return fmt.Sprintf("echo '%s'\n%s\n", Shellquote(usage), d.Get_exit_code(0)), 0
 }
 
-// HelpHandler for go parser which parses docopts options. See: HelpHandler_for_bash_eval for parsing
-// bash options. This handler is called when docopts itself detects a parse error on docopts usage.
-// If docopts parsing is OK, then HelpHandler_for_bash_eval will be called by a second parser based on the
-// help string given with -h <msg> or --help=<msg>. This behavior is a legacy behavior from docopts python
-// previous version. This introduce strange hack in option parsing and may be changed after initial docopts go
-// version release.
-func HelpHandler_golang(err error, usage string) {
+// Golang_help handles a parse error of docopts's own usage, or its help: it
+// returns the message, true if it goes to stderr, and the exit code.
+// Then the bash program's arguments are parsed by a second parser based on
+// the help string given with -h <msg> or --help=<msg>, which outputs bash
+// source code with Bash_eval_help(). This behavior is a legacy behavior from
+// docopts python previous version.
+func Golang_help(err error, usage string) (string, bool, int) {
 	if err != nil {
 		err_str := err.Error()
 		// we hack for our polymorphic argument -h or -V
@@ -333,12 +412,10 @@ func HelpHandler_golang(err error, usage string) {
 		if len(err_str) >= 9 {
 			if err_str[0:2] == "-h" || err_str[0:6] == "--help" {
 				// print full usage message (global var)
-				fmt.Println(strings.TrimSpace(Usage))
-				os.Exit(0)
+				return strings.TrimSpace(Usage) + "\n", false, 0
 			}
 			if err_str[0:2] == "-V" || err_str[0:9] == "--version" {
-				fmt.Println(strings.TrimSpace(Docopts_Version))
-				os.Exit(0)
+				return strings.TrimSpace(Docopts_Version) + "\n", false, 0
 			}
 		}
 
@@ -348,19 +425,40 @@ func HelpHandler_golang(err error, usage string) {
 		if len(err_str) == 0 {
 			// no arg at all, display small usage, also exits 1
 			d := &Docopts{Exit_function: false}
-			d.HelpHandler_for_bash_eval(fmt.Errorf("no argument"), usage)
+			code, exit_code := d.Bash_eval_help(fmt.Errorf("no argument"), usage)
+			return code, false, exit_code
 		}
 
 		// real error
-		fmt.Fprintf(os.Stderr, "my error: %v, %v\n", err, usage)
-		os.Exit(1)
+		return fmt.Sprintf("my error: %v, %v\n", err, usage), true, 1
 	} else {
 		// no error, never reached?
-		fmt.Println(usage)
-		os.Exit(0)
+		return usage + "\n", false, 0
 	}
 }
 
+// Read_msg returns msg or the content of standard input if msg is -
+func Read_msg(msg string) string {
+	if msg == "-" {
+		bytes, _ := ioutil.ReadAll(os.Stdin)
+		msg = string(bytes)
+	}
+	return strings.TrimSpace(msg)
+}
+
+// Parse_verb_args parses a verb's own arguments, any error on the verb
+// usage is displayed and exits.
+func Parse_verb_args(usage string, argv []string) docopt.Opts {
+	parser := &docopt_engine.Parser{
+		HelpHandler: docopt_engine.PrintHelpAndExit,
+	}
+	arguments, err := parser.ParseDoc(usage, argv, Docopts_Version)
+	if err != nil {
+		docopts_error("verb usage: %v", err)
+	}
+	return arguments
+}
+
 func docopts_error(msg string, err error) {
 	if err != nil {
 		msg = fmt.Sprintf(msg, err)
@@ -369,31 +467,87 @@ func docopts_error(msg string, err error) {
 	os.Exit(1)
 }
 
-func main() {
-	golang_parser := &docopt.Parser{
-		OptionsFirst:  true,
-		SkipHelpFlags: true,
-		HelpHandler:   HelpHandler_golang,
+// Docopts_run holds the standard streams of a docopts run: the process ones
+// or the ones of a request to the server.
+type Docopts_run struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+	// if not nil, usages are compiled once and kept here, see serve.go
+	// and --cache
+	Cache *Usage_cache
+	// the environment of the client of the server: NAME=value, nil for the
+	// environment of docopts
+	Env []string
+	// the current directory of the client of the server, "" for the one of
+	// docopts
+	Dir string
+}
+
+// parse_args parses argv with the usage given to docopt by a, compiled once
+// for the annotations and the parsing, see Annotated_usage.Compile().
+func parse_args(parser *docopt_engine.Parser, a *Annotated_usage, argv []string, version string) (docopt.Opts, error) {
+	u, err := a.Compile()
+	if err != nil {
+		return nil, err
 	}
+	return parser.ParseArgs(u, argv, version)
+}
 
-	// build Docopts_Version string
-	Docopts_Version = fmt.Sprintf("docopts %s commit %s built at %s\nbuilt from: %s\n%s",
-		Version,
-		GitCommit,
-		BuildDate,
-		GoBuildVersion,
-		strings.TrimSpace(copyleft))
+// Run is docopts's legacy command line: docopts's own arguments are parsed
+// from args, then the bash program's arguments, the bash code is output and
+// the exit code is returned. As always, an invalid usage message panics.
+func (r *Docopts_run) Run(args []string) int {
+	// set by the HelpHandlers, which don't exit
+	exit_code := -1
 
-	arguments, err := golang_parser.ParseArgs(Usage, nil, Docopts_Version)
+	golang_parser := &docopt_engine.Parser{
+		OptionsFirst:  true,
+		SkipHelpFlags: true,
+		HelpHandler: func(err error, usage string) {
+			var msg string
+			var to_stderr bool
+			msg, to_stderr, exit_code = Golang_help(err, usage)
+			if to_stderr {
+				fmt.Fprint(r.Stderr, msg)
+			} else {
+				fmt.Fprint(r.Stdout, msg)
+			}
+		},
+	}
 
+	// docopts's own usage has no annotation
+	own := &Annotated_usage{Doc: Usage, cache: r.Cache}
+	arguments, err := parse_args(golang_parser, own, args, Docopts_Version)
+	if exit_code >= 0 {
+		return exit_code
+	}
 	if err != nil {
 		msg := fmt.Sprintf("mypanic: %v\n", err)
 		panic(msg)
 	}
 
+	// the server ignores --connect given by the client
+	socket, err := arguments.String("--connect")
+	if err == nil && r.Cache == nil {
+		with_stdin := arguments["--help"] == "-" || arguments["--version"] == "-"
+		return r.Connect(socket, args, with_stdin)
+	}
+
 	debug := arguments["--debug"].(bool)
 	if debug {
-		print_args(arguments, "golang")
+		print_args(r.Stdout, arguments, "golang")
+	}
+
+	// the server has its own cache in memory
+	cache := r.Cache
+	if cache == nil {
+		cache_dir, err := arguments.String("--cache-dir")
+		if err == nil {
+			cache = New_disk_cache(cache_dir)
+		} else if arguments["--cache"].(bool) {
+			cache = New_disk_cache(Default_cache_dir())
+		}
 	}
 
 	// create our Docopts struct
@@ -403,6 +557,7 @@ func main() {
 		Output_declare: true,
 		// Exit_function is experimental
 		Exit_function: false,
+		Output:        r.Stdout,
 	}
 
 	// parse docopts's own arguments
@@ -421,7 +576,7 @@ func main() {
 
 	// read from stdin
 	if doc == "-" && bash_version == "-" {
-		bytes, _ := ioutil.ReadAll(os.Stdin)
+		bytes, _ := ioutil.ReadAll(r.Stdin)
 		arr := strings.Split(string(bytes), separator)
 		if len(arr) == 2 {
 			doc, bash_version = arr[0], arr[1]
@@ -434,46 +589,111 @@ func main() {
 			panic(msg)
 		}
 	} else if doc == "-" {
-		bytes, _ := ioutil.ReadAll(os.Stdin)
+		bytes, _ := ioutil.ReadAll(r.Stdin)
 		doc = string(bytes)
 	} else if bash_version == "-" {
-		bytes, _ := ioutil.ReadAll(os.Stdin)
+		bytes, _ := ioutil.ReadAll(r.Stdin)
 		bash_version = string(bytes)
 	}
 
 	doc = strings.TrimSpace(doc)
 	bash_version = strings.TrimSpace(bash_version)
 	if debug {
-		fmt.Printf("%20s : %v\n", "doc", doc)
-		fmt.Printf("%20s : %v\n", "bash_version", bash_version)
+		fmt.Fprintf(r.Stdout, "%20s : %v\n", "doc", doc)
+		fmt.Fprintf(r.Stdout, "%20s : %v\n", "bash_version", bash_version)
 	}
 
 	// now parses bash program's arguments
-	parser := &docopt.Parser{
-		HelpHandler:   d.HelpHandler_for_bash_eval,
+	parser := &docopt_engine.Parser{
+		HelpHandler: func(err error, usage string) {
+			var code string
+			code, exit_code = d.Bash_eval_help(err, usage)
+			fmt.Fprint(r.Stdout, code)
+		},
 		OptionsFirst:  options_first,
 		SkipHelpFlags: no_help,
 	}
-	bash_args, err := parser.ParseArgs(doc, argv, bash_version)
+	annotated, err := Parse_annotations_cached(doc, cache)
+	if err != nil {
+		panic(err)
+	}
+	if r.Env != nil {
+		annotated.Env = Environ_map(r.Env)
+	}
+	annotated.Dir = r.Dir
+	if config_file, err := arguments.String("--config"); err == nil {
+		annotated.Config_file = config_file
+		annotated.Remove_defaults()
+	}
+	parser.HelpHandler = annotated.Help_handler(parser.HelpHandler)
+	bash_args, err := annotated.Parse_argv(parser, argv, bash_version)
+	if exit_code >= 0 {
+		return exit_code
+	}
+	if err != nil {
+		panic(err)
+	}
+	for _, warning := range annotated.Warnings {
+		fmt.Fprintf(r.Stdout, "echo '%s' >&2\n", Shellquote(warning))
+	}
+
+	if debug {
+		print_args(r.Stdout, bash_args, "bash")
+		print_sources(r.Stdout, annotated.Sources())
+		fmt.Fprintln(r.Stdout, "----------------------------------------")
+	}
+	name, err := arguments.String("-A")
 	if err == nil {
-		if debug {
-			print_args(bash_args, "bash")
-			fmt.Println("----------------------------------------")
+		if !IsBashIdentifier(name) {
+			fmt.Fprintf(r.Stdout, "-A: not a valid Bash identifier: '%s'", name)
+			return 0
 		}
-		name, err := arguments.String("-A")
+		d.Print_bash_args(name, bash_args)
+	} else {
+		err = d.Print_bash_global(bash_args)
+		if err != nil {
+			fmt.Fprintf(r.Stderr, "docopts:error: Print_bash_global:%v\n", err)
+			return 1
+		}
+	}
+
+	prefix, err := arguments.String("--dispatch")
+	if err == nil {
+		m, err := annotated.Model()
 		if err == nil {
-			if !IsBashIdentifier(name) {
-				fmt.Printf("-A: not a valid Bash identifier: '%s'", name)
-				return
-			}
-			d.Print_bash_args(name, bash_args)
-		} else {
-			err = d.Print_bash_global(bash_args)
-			if err != nil {
-				docopts_error("Print_bash_global:%v", err)
-			}
+			err = d.Print_dispatch(prefix, m, bash_args)
 		}
-	} else {
-		panic(err)
+		if err != nil {
+			fmt.Fprintf(r.Stderr, "docopts:error: Print_dispatch:%v\n", err)
+			return 1
+		}
+	}
+	return 0
+}
+
+func main() {
+	// build Docopts_Version string
+	Docopts_Version = fmt.Sprintf("docopts %s commit %s built at %s\nbuilt from: %s\n%s",
+		Version,
+		GitCommit,
+		BuildDate,
+		GoBuildVersion,
+		strings.TrimSpace(copyleft))
+
+	// installed as a link named docopts-run, docopts is a script interpreter
+	name := strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe")
+	if name == "docopts-run" {
+		os.Exit(verbs["run"](append([]string{"run"}, os.Args[1:]...)))
 	}
+
+	// legacy usage always starts with an option, so a first word is a verb,
+	// the verb is kept in argv as it is part of its own usage
+	if len(os.Args) > 1 {
+		if verb, found := verbs[os.Args[1]]; found {
+			os.Exit(verb(os.Args[1:]))
+		}
+	}
+
+	r := &Docopts_run{Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr}
+	os.Exit(r.Run(os.Args[1:]))
 }
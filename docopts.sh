@@ -165,6 +165,41 @@ docopt_auto_parse() {
     return $res
 }
 
+# Doc:
+# Start a docopts server as a bash coprocess, docopt_coproc then replaces
+# docopts calls without starting a new process for each call.
+# Usage:
+#   docopt_coproc_start
+#   eval "$(docopt_coproc -A ARGS -h "$help" : "$@")"
+# coproc needs bash 4+, it is hidden in eval so bash 3.2 can still source
+# this file.
+docopt_coproc_start() {
+    if [[ ${BASH_VERSINFO[0]} -lt 4 ]] ; then
+        echo "docopt_coproc_start: coproc needs bash 4+, this is bash $BASH_VERSION" >&2
+        return 1
+    fi
+    eval 'coproc DOCOPT_COPROC { docopts serve --stdio; }'
+}
+
+# Doc:
+# Same arguments, output and exit code as docopts, the parsing is done by the
+# server started with docopt_coproc_start. The exported variables are sent,
+# for [env: NAME], and the current directory for relative paths.
+# Standard input is not sent to the server: -h - is not supported.
+docopt_coproc() {
+    local exit_code stdout stderr name env=()
+    for name in $(compgen -e) ; do
+        env+=("$name=${!name}")
+    done
+    printf '%s\0' $# "$@" "" ${#env[@]} "${env[@]}" "$PWD" >&${DOCOPT_COPROC[1]}
+    IFS= read -r -d '' exit_code <&${DOCOPT_COPROC[0]}
+    IFS= read -r -d '' stdout <&${DOCOPT_COPROC[0]}
+    IFS= read -r -d '' stderr <&${DOCOPT_COPROC[0]}
+    printf '%s' "$stdout"
+    printf '%s' "$stderr" >&2
+    return $exit_code
+}
+
 # Doc:
 # Extract the raw value of a parsed docopts output.
 # arguments:
@@ -216,8 +251,34 @@ docopt_print_ARGS() {
     fi
 }
 
+# Doc:
+# Warn on stderr if the given docopts.sh file is not the one embedded in
+# docopts, returns 1 in this case. Used by --auto.
+# Files which are not regular files are not checked: source <(docopts lib)
+# An older docopts without the lib verb outputs its usage: nothing is output
+# on stdout, a single warning is output on stderr.
+# Usage: docopt_check_lib "${BASH_SOURCE[0]}"
+docopt_check_lib() {
+    if [[ ! -f "$1" ]] ; then
+        return 0
+    fi
+    local output status
+    output=$(docopts lib --check "$1" 2>&1)
+    status=$?
+    if [[ $status -eq 0 ]] ; then
+        return 0
+    fi
+    if [[ $status -eq 1 && "$output" == "docopts.sh: warning: "* ]] ; then
+        echo "$output" >&2
+    else
+        echo "docopts.sh: warning: docopts has no lib verb, $1 is not checked: update docopts" >&2
+    fi
+    return 1
+}
+
 ## main code if sourced with arguments
 if [[ $# -ge 1 && "$1" == "--auto" ]] ; then
+    docopt_check_lib "${BASH_SOURCE[0]}" || true
     if [[ $# -ge 2 && $2 == '-G' ]] ; then
         shift 2
         eval "$(docopt_auto_parse -G "${BASH_SOURCE[1]}" "$@")"
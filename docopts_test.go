@@ -154,6 +154,8 @@ func TestTo_bash(t *testing.T) {
 		{"", "''"},
 		{[]string{"pipo", "molo"}, "('pipo' 'molo')"},
 		{true, "true"},
+		{map[string]string{"b": "2", "a": "1"}, "(['a']='1' ['b']='2')"},
+		{map[string]string{}, "()"},
 	}
 
 	for _, table := range tables {
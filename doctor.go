@@ -0,0 +1,180 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// doctor.go implements the verb: docopts doctor
+//
+// The environment docopts and docopts.sh run in is checked: bash features,
+// docopts.sh found on PATH, awk and sed flavours and the build metadata.
+//
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+var Usage_doctor string = `Check the environment of docopts and docopts.sh.
+
+Usage:
+  docopts doctor [--bash=<path>]
+  docopts doctor --help
+
+Options:
+  --bash=<path>  The bash to check [default: bash].
+
+Reported: the build metadata, the bash version and its support of associative
+arrays (-A) and namerefs, the docopts.sh found on PATH compared to the one
+embedded in docopts, the awk and sed flavours used by docopts.sh.
+The exit code is 1 if a warning is reported, 0 otherwise.
+`
+
+func init() {
+	verbs["doctor"] = Verb_doctor
+}
+
+func Verb_doctor(argv []string) int {
+	arguments := Parse_verb_args(Usage_doctor, argv)
+	warnings := 0
+	report := func(name string, format string, a ...interface{}) {
+		fmt.Fprintf(out, "%-12s %s\n", name+":", fmt.Sprintf(format, a...))
+	}
+	warn := func(format string, a ...interface{}) {
+		fmt.Fprintf(out, "%-12s %s\n", "warning:", fmt.Sprintf(format, a...))
+		warnings++
+	}
+
+	report("docopts", "%s", or_unknown(Version))
+	report("commit", "%s", or_unknown(GitCommit))
+	report("built at", "%s", or_unknown(BuildDate))
+	report("built from", "%s", or_unknown(GoBuildVersion))
+	report("go runtime", "%s %s/%s", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+
+	bash := arguments["--bash"].(string)
+	bash_path, err := exec.LookPath(bash)
+	if err != nil {
+		warn("bash not found: %s", bash)
+	} else {
+		output, _ := exec.Command(bash_path, "-c", `echo "$BASH_VERSION"`).Output()
+		version := strings.TrimSpace(string(output))
+		major, minor, err := Parse_bash_version(version)
+		if err != nil {
+			warn("%s: %v", bash_path, err)
+		} else {
+			assoc, nameref := Bash_features(major, minor)
+			report("bash", "%s %s", bash_path, version)
+			report("  -A", "%s", yes_no(assoc, "associative arrays supported", "associative arrays not supported (bash 4+ needed)"))
+			report("  nameref", "%s", yes_no(nameref, "declare -n supported", "declare -n not supported (bash 4.3+ needed)"))
+			if !assoc {
+				warn("bash %d.%d: use -G <prefix> instead of -A, and: source docopts.sh --auto -G", major, minor)
+			}
+		}
+	}
+
+	lib_path, err := Find_sourceable("docopts.sh", os.Getenv("PATH"))
+	if err != nil {
+		report("docopts.sh", "not found on PATH, the embedded one is used with: source <(docopts lib)")
+	} else if err = Check_lib(lib_path); err != nil {
+		report("docopts.sh", "%s", lib_path)
+		warn("%v, update it with: docopts lib > %s", err, lib_path)
+	} else {
+		report("docopts.sh", "%s matches this docopts", lib_path)
+	}
+
+	for _, tool := range []struct {
+		name string
+		args [][]string
+	}{
+		{"awk", [][]string{{"--version"}, {"-W", "version"}}},
+		{"sed", [][]string{{"--version"}}},
+	} {
+		path, err := exec.LookPath(tool.name)
+		if err != nil {
+			warn("%s not found, docopts.sh needs it", tool.name)
+			continue
+		}
+		flavour := ""
+		for _, args := range tool.args {
+			output, _ := exec.Command(path, args...).CombinedOutput()
+			if flavour = Tool_flavour(tool.name, string(output)); flavour != "" {
+				break
+			}
+		}
+		if flavour == "" {
+			flavour = "BSD or unknown"
+		}
+		report(tool.name, "%s %s", path, flavour)
+	}
+
+	if warnings > 0 {
+		return 1
+	}
+	return 0
+}
+
+// Parse_bash_version returns major and minor of a $BASH_VERSION string.
+func Parse_bash_version(version string) (int, int, error) {
+	m := regexp.MustCompile(`^(\d+)\.(\d+)`).FindStringSubmatch(version)
+	if m == nil {
+		return 0, 0, fmt.Errorf("cannot read bash version: '%s'", version)
+	}
+	major, _ := strconv.Atoi(m[1])
+	minor, _ := strconv.Atoi(m[2])
+	return major, minor, nil
+}
+
+// Bash_features returns the support of associative arrays (declare -A) and
+// namerefs (declare -n) by a bash version.
+func Bash_features(major, minor int) (assoc bool, nameref bool) {
+	return major >= 4, major > 4 || (major == 4 && minor >= 3)
+}
+
+// Tool_flavour returns the flavour of awk or sed from the output of its
+// version option, or an empty string if unknown.
+func Tool_flavour(name string, version_output string) string {
+	switch {
+	case strings.Contains(version_output, "BusyBox"),
+		strings.Contains(version_output, "not GNU sed"):
+		return "BusyBox"
+	case strings.Contains(version_output, "GNU"):
+		return "GNU " + name
+	case name == "awk" && strings.HasPrefix(version_output, "mawk"):
+		return "mawk"
+	case name == "awk" && strings.HasPrefix(version_output, "awk version"):
+		return "BSD awk (one true awk)"
+	}
+	return ""
+}
+
+// Find_sourceable returns the file found by bash's source in the directories of
+// path: a readable regular file, unlike exec.LookPath it needs no exec bit.
+func Find_sourceable(name string, path string) (string, error) {
+	for _, dir := range filepath.SplitList(path) {
+		if dir == "" {
+			dir = "."
+		}
+		file := filepath.Join(dir, name)
+		if info, err := os.Stat(file); err == nil && info.Mode().IsRegular() && is_readable(file) {
+			return file, nil
+		}
+	}
+	return "", fmt.Errorf("%s not found in PATH", name)
+}
+
+func or_unknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
+
+func yes_no(b bool, yes string, no string) string {
+	if b {
+		return yes
+	}
+	return no
+}
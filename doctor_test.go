@@ -0,0 +1,114 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// unit test for doctor.go
+//
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParse_bash_version(t *testing.T) {
+	tables := []struct {
+		version    string
+		major      int
+		minor      int
+		expect_err bool
+	}{
+		{"5.1.16(1)-release", 5, 1, false},
+		{"3.2.57(1)-release", 3, 2, false},
+		{"4.3.48(1)-release", 4, 3, false},
+		{"", 0, 0, true},
+		{"zsh 5.8", 0, 0, true},
+	}
+	for _, table := range tables {
+		major, minor, err := Parse_bash_version(table.version)
+		if (err != nil) != table.expect_err {
+			t.Errorf("Parse_bash_version(%q): got error %v, want error: %v", table.version, err, table.expect_err)
+			continue
+		}
+		if major != table.major || minor != table.minor {
+			t.Errorf("Parse_bash_version(%q): got %d.%d, want %d.%d", table.version, major, minor, table.major, table.minor)
+		}
+	}
+}
+
+func TestBash_features(t *testing.T) {
+	tables := []struct {
+		major   int
+		minor   int
+		assoc   bool
+		nameref bool
+	}{
+		{3, 2, false, false},
+		{4, 0, true, false},
+		{4, 3, true, true},
+		{5, 0, true, true},
+	}
+	for _, table := range tables {
+		assoc, nameref := Bash_features(table.major, table.minor)
+		if assoc != table.assoc || nameref != table.nameref {
+			t.Errorf("Bash_features(%d, %d): got %v %v, want %v %v", table.major, table.minor, assoc, nameref, table.assoc, table.nameref)
+		}
+	}
+}
+
+func TestTool_flavour(t *testing.T) {
+	tables := []struct {
+		name   string
+		output string
+		expect string
+	}{
+		{"awk", "GNU Awk 5.1.0, API: 3.0 (GNU MPFR 4.1.0, GNU MP 6.2.1)\n", "GNU awk"},
+		{"awk", "mawk 1.3.4 20200120\n", "mawk"},
+		{"awk", "awk version 20200816\n", "BSD awk (one true awk)"},
+		{"awk", "BusyBox v1.36.1 (2023-06-20) multi-call binary.\n", "BusyBox"},
+		{"awk", "awk: unknown option --version ignored\n", ""},
+		{"sed", "sed (GNU sed) 4.8\n", "GNU sed"},
+		{"sed", "This is not GNU sed version 4.0\n", "BusyBox"},
+		{"sed", "sed: illegal option -- -\n", ""},
+	}
+	for _, table := range tables {
+		if got := Tool_flavour(table.name, table.output); got != table.expect {
+			t.Errorf("Tool_flavour(%s, %q): got %q, want %q", table.name, table.output, got, table.expect)
+		}
+	}
+}
+
+func TestFind_sourceable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docopts-doctor-")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// a directory is skipped, a file without exec bit is found
+	as_dir := filepath.Join(dir, "a")
+	os.MkdirAll(filepath.Join(as_dir, "docopts.sh"), 0755)
+	no_exec := filepath.Join(dir, "b")
+	os.Mkdir(no_exec, 0755)
+	ioutil.WriteFile(filepath.Join(no_exec, "docopts.sh"), []byte("# lib\n"), 0644)
+	empty := filepath.Join(dir, "c")
+	os.Mkdir(empty, 0755)
+
+	tables := []struct {
+		path   string
+		expect string
+	}{
+		{as_dir + ":" + no_exec, filepath.Join(no_exec, "docopts.sh")},
+		{empty + ":" + as_dir, ""},
+		{"", ""},
+	}
+	for _, table := range tables {
+		got, err := Find_sourceable("docopts.sh", table.path)
+		if got != table.expect {
+			t.Errorf("Find_sourceable(%q): got %q, want %q", table.path, got, table.expect)
+		}
+		if table.expect == "" && err == nil {
+			t.Errorf("Find_sourceable(%q): error expected", table.path)
+		}
+	}
+}
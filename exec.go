@@ -0,0 +1,246 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// exec.go implements the verb: docopts exec
+//
+// The parsed arguments are exported as environment variables and the command
+// is executed in place of docopts: no bash eval is involved.
+//
+package main
+
+import (
+	"fmt"
+	"github.com/docopt/docopt-go"
+	"github.com/docopt/docopts/docopt_engine"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+var Usage_exec string = `Run a command with the parsed arguments exported as environment variables.
+
+Usage:
+  docopts exec [options] -h <msg> : [<argv>...]
+  docopts exec --help
+
+Options:
+  -h <msg>               The usage message in docopt format. If - is given,
+                         read the usage message from standard input.
+  -V <msg>               A version message.
+  -O, --options-first    Disallow interspersing options and positional
+                         arguments, see docopts --help.
+  -H, --no-help          Don't handle --help and --version specially.
+  --env-prefix=<prefix>  Prepended to the variable names, which are mangled as
+                         for docopts -G.
+  --join=<sep>           Export arrays as one variable, values joined by <sep>.
+                         Without it, arrays are exported as <name>_COUNT and
+                         <name>_0, <name>_1, ...
+  --argc=<n>             The count of <argv>, the command follows the -- after
+                         them: <argv> may contain --.
+  --help                 Show this help.
+
+<argv> ends at the first -- followed by the command, which is searched in
+$PATH:
+  docopts exec -h "$usage" --env-prefix APP_ : "$@" -- /usr/bin/real-tool
+<argv> cannot contain -- unless its count is given:
+  docopts exec -h "$usage" --argc=$# : "$@" -- /usr/bin/real-tool
+
+Boolean values are exported as true or false, arguments or options not given
+are removed from the environment. A usage error is displayed with the usage
+message and the exit code is 64, the help or version is displayed with the
+exit code 0: in both cases the command is not run. As in the shell, the exit
+code is 127 if the command is not found, 126 if it cannot be run.
+`
+
+func init() {
+	verbs["exec"] = Verb_exec
+}
+
+func Verb_exec(argv []string) int {
+	// docopts's own options end at ':'. The program arguments may contain
+	// anything, so they are split manually: the command follows the first --,
+	// or the -- after --argc arguments.
+	colon := len(argv)
+	for i, a := range argv {
+		if a == ":" {
+			colon = i
+			break
+		}
+	}
+	if colon == len(argv) {
+		// --help, or the verb usage reports the missing ':'
+		Parse_verb_args(Usage_exec, argv)
+		docopts_error("exec: %v", fmt.Errorf("':' not found"))
+	}
+	// only docopts's own options are parsed by the verb usage
+	arguments := Parse_verb_args(Usage_exec, argv[:colon+1])
+	separator, err := Command_separator(argv[colon+1:], arguments["--argc"])
+	if err != nil {
+		docopts_error("exec: %v", err)
+	}
+	separator += colon + 1
+	prog_argv := argv[colon+1 : separator]
+	command := argv[separator+1:]
+
+	d := &Docopts{Mangle_key: true}
+	env_prefix, _ := arguments.String("--env-prefix")
+	join, join_err := arguments.String("--join")
+	version, _ := arguments.String("-V")
+	doc := Read_msg(arguments["-h"].(string))
+
+	exit_code := -1
+	parser := &docopt_engine.Parser{
+		HelpHandler:   Direct_help_handler(&exit_code),
+		OptionsFirst:  arguments["--options-first"].(bool),
+		SkipHelpFlags: arguments["--no-help"].(bool),
+	}
+	annotated, err := Parse_annotations(doc)
+	if err != nil {
+		docopts_error("exec: %v", err)
+	}
+	parser.HelpHandler = annotated.Help_handler(parser.HelpHandler)
+	args, err := annotated.Parse_argv(parser, prog_argv, strings.TrimSpace(version))
+	if exit_code >= 0 {
+		return exit_code
+	}
+	if err != nil {
+		docopts_error("exec: %v", err)
+	}
+	for _, warning := range annotated.Warnings {
+		fmt.Fprintln(os.Stderr, warning)
+	}
+
+	env, err := d.Environment(args, env_prefix, join, join_err == nil)
+	if err != nil {
+		docopts_error("exec: %v", err)
+	}
+	for name, value := range env {
+		if value == nil {
+			os.Unsetenv(name)
+		} else {
+			os.Setenv(name, *value)
+		}
+	}
+
+	// exit codes of the shell for a command not found or not executable
+	path, err := exec.LookPath(command[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "docopts:error: %v\n", err)
+		return 127
+	}
+	err = Exec_command(path, command)
+	fmt.Fprintf(os.Stderr, "docopts:error: exec: %v\n", err)
+	return 126
+}
+
+// Command_separator returns the index of the -- followed by the command in
+// argv: the first one, or the one after argc arguments if argc is given.
+func Command_separator(argv []string, argc interface{}) (int, error) {
+	separator := -1
+	if argc, ok := argc.(string); ok {
+		n, err := strconv.Atoi(argc)
+		if err != nil || n < 0 {
+			return -1, fmt.Errorf("--argc: not a count: '%s'", argc)
+		}
+		if n < len(argv) && argv[n] == "--" {
+			separator = n
+		} else {
+			return -1, fmt.Errorf("-- not found after the %d arguments of --argc", n)
+		}
+	} else {
+		for i, a := range argv {
+			if a == "--" {
+				separator = i
+				break
+			}
+		}
+	}
+	if separator < 0 || separator == len(argv)-1 {
+		return -1, fmt.Errorf("command not found after: --")
+	}
+	return separator, nil
+}
+
+// Direct_help_handler returns a HelpHandler displaying the help or version on
+// stdout and setting exit_code to 0, or the usage error on stderr and setting
+// exit_code to 64. No bash code is output.
+func Direct_help_handler(exit_code *int) func(err error, usage string) {
+	return func(err error, usage string) {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n%s\n", err, usage)
+			*exit_code = 64
+		} else {
+			fmt.Fprintln(out, usage)
+			*exit_code = 0
+		}
+	}
+}
+
+// Environment returns the variables for args: names are prefix followed by
+// the names given by Name_mangle() without Global_prefix, a nil value is to
+// be removed from the environment. If use_join, arrays are one variable with
+// values joined by join.
+func (d *Docopts) Environment(args docopt.Opts, prefix string, join string, use_join bool) (map[string]*string, error) {
+	env := make(map[string]*string)
+	keys := make(map[string]string)
+	set := func(key string, name string, value *string) error {
+		if !IsBashIdentifier(name) {
+			return fmt.Errorf("cannot transform into an environment variable name: '%s' => '%s'", key, name)
+		}
+		if prev_key, seen := keys[name]; seen {
+			return fmt.Errorf("%s: two or more elements have identically mangled names", prev_key)
+		}
+		keys[name] = key
+		env[name] = value
+		return nil
+	}
+
+	for _, key := range Sort_args_keys(args) {
+		if key == "--" {
+			// as in global mode without prefix, double-dash can't be mangled
+			continue
+		}
+		name, err := d.Name_mangle(key)
+		if err != nil {
+			return nil, err
+		}
+		name = prefix + name
+
+		var value *string
+		arg := args[key]
+		if m, is_map := arg.(map[string]string); is_map {
+			// exported as an array of key=value
+			arg = Map_items(m)
+		}
+		switch v := arg.(type) {
+		case nil:
+		case string:
+			value = &v
+		case bool, int, float64:
+			s := To_string(v)
+			value = &s
+		case []string:
+			if use_join {
+				s := strings.Join(v, join)
+				value = &s
+				break
+			}
+			count := fmt.Sprintf("%d", len(v))
+			if err := set(key, name+"_COUNT", &count); err != nil {
+				return nil, err
+			}
+			for i := range v {
+				if err := set(key, fmt.Sprintf("%s_%d", name, i), &v[i]); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		default:
+			return nil, fmt.Errorf("unsupported type: %T for '%s'", v, key)
+		}
+		if err := set(key, name, value); err != nil {
+			return nil, err
+		}
+	}
+	return env, nil
+}
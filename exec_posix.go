@@ -0,0 +1,19 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// exec_posix.go: the command replaces docopts.
+//
+
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// Exec_command replaces docopts by the command, it returns only on error.
+func Exec_command(path string, argv []string) error {
+	return syscall.Exec(path, argv, os.Environ())
+}
@@ -0,0 +1,113 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// unit test for exec.go
+//
+package main
+
+import (
+	"github.com/docopt/docopt-go"
+	"testing"
+)
+
+func TestEnvironment(t *testing.T) {
+	args := docopt.Opts{
+		"--verbose": true,
+		"-q":        false,
+		"--count":   2,
+		"--name":    "my name",
+		"--output":  nil,
+		"<file>":    []string{"a", "b c"},
+		"--":        true,
+		"add":       true,
+	}
+	tables := []struct {
+		prefix   string
+		join     string
+		use_join bool
+		expect   map[string]string
+		unset    []string
+	}{
+		{
+			"APP_", "", false,
+			map[string]string{
+				"APP_verbose":    "true",
+				"APP_q":          "false",
+				"APP_count":      "2",
+				"APP_name":       "my name",
+				"APP_file_COUNT": "2",
+				"APP_file_0":     "a",
+				"APP_file_1":     "b c",
+				"APP_add":        "true",
+			},
+			[]string{"APP_output"},
+		},
+		{
+			"", ":", true,
+			map[string]string{
+				"verbose": "true",
+				"file":    "a:b c",
+			},
+			[]string{"output"},
+		},
+	}
+
+	d := &Docopts{Mangle_key: true}
+	for _, table := range tables {
+		env, err := d.Environment(args, table.prefix, table.join, table.use_join)
+		if err != nil {
+			t.Errorf("Environment prefix '%s' error: %v", table.prefix, err)
+			continue
+		}
+		for name, value := range table.expect {
+			if env[name] == nil || *env[name] != value {
+				t.Errorf("Environment prefix '%s': %s got: %v, want: '%s'", table.prefix, name, env[name], value)
+			}
+		}
+		for _, name := range table.unset {
+			if value, found := env[name]; !found || value != nil {
+				t.Errorf("Environment prefix '%s': %s must be unset, got: %v", table.prefix, name, value)
+			}
+		}
+	}
+
+	errors := []docopt.Opts{
+		{"--long-option": true, "<long-option>": "a"},
+		{"<file>": []string{"a"}, "--file-COUNT": true},
+		{"-": true},
+	}
+	for _, args := range errors {
+		if _, err := d.Environment(args, "", "", false); err == nil {
+			t.Errorf("Environment %v: expecting error", args)
+		}
+	}
+	if _, err := d.Environment(docopt.Opts{"-v": true}, "1", "", false); err == nil {
+		t.Errorf("Environment: expecting error on invalid prefix")
+	}
+}
+
+func TestCommand_separator(t *testing.T) {
+	tables := []struct {
+		argv   []string
+		argc   interface{}
+		expect int
+	}{
+		{[]string{"a", "--", "cmd"}, nil, 1},
+		{[]string{"--", "cmd"}, nil, 0},
+		// the first --, the command may contain --
+		{[]string{"x", "--", "printf", "%s\n", "--", "y"}, nil, 1},
+		// <argv> contains -- given its count
+		{[]string{"--", "a", "--", "cmd", "--"}, "2", 2},
+		{[]string{"--", "cmd"}, "0", 0},
+		{[]string{"a", "--"}, nil, -1},
+		{[]string{"a", "b"}, nil, -1},
+		{[]string{"a", "--", "cmd"}, "2", -1},
+		{[]string{"a", "--", "cmd"}, "-1", -1},
+		{[]string{"a", "--", "cmd"}, "a", -1},
+	}
+	for _, table := range tables {
+		got, err := Command_separator(table.argv, table.argc)
+		if got != table.expect || (err != nil) != (table.expect < 0) {
+			t.Errorf("Command_separator(%q, %v): got %d %v, want %d", table.argv, table.argc, got, err, table.expect)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// exec_windows.go: Windows has no exec, the command is run as a child process
+// and its exit code is ours.
+//
+package main
+
+import (
+	"os"
+	"os/exec"
+)
+
+// Exec_command runs the command and exits with its exit code, it returns
+// only on error.
+func Exec_command(path string, argv []string) error {
+	cmd := exec.Command(path, argv[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	if exit_err, ok := err.(*exec.ExitError); ok {
+		os.Exit(exit_err.ExitCode())
+	}
+	if err != nil {
+		return err
+	}
+	os.Exit(0)
+	return nil
+}
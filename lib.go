@@ -0,0 +1,69 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// lib.go implements the verb: docopts lib
+//
+// docopts.sh is embedded in the binary, so the helper always matches the
+// docopts parsing it: source <(docopts lib)
+//
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+//go:embed docopts.sh
+var Docopts_sh string
+
+var Usage_lib string = `Output the docopts.sh helper embedded in this docopts.
+
+Usage:
+  docopts lib
+  docopts lib --check <file>
+  docopts lib --help
+
+Options:
+  --check <file>  Compare <file> to the embedded docopts.sh, exit 1 with a
+                  warning on standard error if they differ.
+
+The helper is sourced from the binary with:
+  source <(docopts lib)
+  source <(docopts lib) --auto "$@"
+docopts.sh sourced with --auto checks itself with --check.
+`
+
+func init() {
+	verbs["lib"] = Verb_lib
+}
+
+func Verb_lib(argv []string) int {
+	arguments := Parse_verb_args(Usage_lib, argv)
+
+	if arguments["--check"] == nil {
+		fmt.Fprint(out, Docopts_sh)
+		return 0
+	}
+
+	filename := arguments["--check"].(string)
+	err := Check_lib(filename)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "docopts.sh: warning: %v\n", err)
+		fmt.Fprintf(os.Stderr, "docopts.sh: warning: use the helper embedded in docopts: source <(docopts lib)\n")
+		return 1
+	}
+	return 0
+}
+
+// Check_lib returns an error if filename is not the embedded docopts.sh.
+func Check_lib(filename string) error {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	if string(content) != Docopts_sh {
+		return fmt.Errorf("%s differs from the docopts.sh embedded in docopts", filename)
+	}
+	return nil
+}
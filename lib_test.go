@@ -0,0 +1,46 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// unit test for lib.go
+//
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestCheck_lib(t *testing.T) {
+	if Docopts_sh == "" {
+		t.Fatalf("Docopts_sh is empty")
+	}
+	tmp, err := ioutil.TempFile("", "docopts.sh-")
+	if err != nil {
+		t.Fatalf("TempFile: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	tmp.Close()
+
+	tables := []struct {
+		content    string
+		expect_err bool
+	}{
+		{Docopts_sh, false},
+		{Docopts_sh + "# modified\n", true},
+		{"", true},
+	}
+	for _, table := range tables {
+		ioutil.WriteFile(tmp.Name(), []byte(table.content), 0644)
+		err := Check_lib(tmp.Name())
+		if (err != nil) != table.expect_err {
+			t.Errorf("Check_lib(%d bytes): got error %v, want error: %v", len(table.content), err, table.expect_err)
+		}
+	}
+
+	if err := Check_lib("docopts.sh"); err != nil {
+		t.Errorf("Check_lib(docopts.sh): %v", err)
+	}
+	if err := Check_lib("not_found.sh"); err == nil {
+		t.Errorf("Check_lib(not_found.sh): no error")
+	}
+}
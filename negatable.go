@@ -0,0 +1,145 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// negatable.go implements the negatable flags: --[no-]name
+//
+//	Usage: prog [--[no-]color]
+//
+//	Options:
+//	  --[no-]color  Colorize the output [default: true]
+//
+// docopt is given two flags: --name and --no-name, both optional. The output
+// is a single value for --name: true or false, the last given on argv wins.
+// If none is given, the value is filled as any option, from its default
+// [default: true|false] or another source, else it is nil.
+//
+// A short alias, -c, --[no-]color, is an alias of --color: it gives true.
+//
+package main
+
+import (
+	"fmt"
+	"github.com/docopt/docopt-go"
+	"regexp"
+	"strings"
+)
+
+var re_negatable = regexp.MustCompile(`--\[no-\]([A-Za-z0-9][A-Za-z0-9_-]*)`)
+
+func init() {
+	Register_syntax("negatable")
+}
+
+// rewrite_negatables rewrites --[no-]name in the lines given to docopt: the
+// options entry describes --name, and --no-name on an added line, the usage
+// gives both as optional. It returns the first line of the entries of the
+// negatable options.
+func (a *Annotated_usage) rewrite_negatables() map[int]bool {
+	entries := make(map[int]bool)
+	for _, entry := range a.entries {
+		for _, option := range entry_options(a.lines, entry) {
+			if strings.HasPrefix(option, "--[no-]") {
+				entries[entry[0]] = true
+			}
+		}
+	}
+	for i, line := range a.lines {
+		if !re_negatable.MatchString(line) {
+			continue
+		}
+		if entries[i] {
+			// the line count is kept: Doc is made of the joined lines
+			name := re_negatable.FindStringSubmatch(line)[1]
+			a.lines[i] = strings.Replace(line, "--[no-]"+name, "--"+name, 1) + "\n  --no-" + name
+		} else {
+			a.lines[i] = re_negatable.ReplaceAllString(line, "[--$1] [--no-$1]")
+		}
+	}
+	return entries
+}
+
+// compile_negatable checks the negatable option e, its [default: x] is
+// applied by Apply() as the default of an option with an argument.
+func (a *Annotated_usage) compile_negatable(e *Annotated_element) error {
+	if e.Option.Argcount > 0 {
+		return fmt.Errorf("%s: --[no-]name takes no argument", e.Key)
+	}
+	e.Negatable = true
+	m := regexp.MustCompile(`(?i)\[default: ([^\]]*)\]`).FindStringSubmatch(entry_text(a.lines, e.entry))
+	if m == nil {
+		return nil
+	}
+	if _, err := Parse_bool(m[1]); err != nil {
+		return fmt.Errorf("%s: default is not a bool: %s", e.Key, m[1])
+	}
+	e.Option.Default = m[1]
+	e.Option.Has_default = true
+	a.remove_default(e)
+	return nil
+}
+
+// fill_negatable sets the value of --name given on argv: true for --name,
+// false for --no-name, whose value is removed from args. If none is given,
+// --name is filled as an option with an argument, and the value converted.
+func (a *Annotated_usage) fill_negatable(e *Annotated_element, args docopt.Opts) error {
+	negative := "--no-" + strings.TrimPrefix(e.Key, "--")
+	positive_given, negative_given := args[e.Key] == true, args[negative] == true
+	delete(args, negative)
+	if positive_given || negative_given {
+		if positive_given && negative_given {
+			args[e.Key] = a.last_given(e.Key, negative) == e.Key
+		} else {
+			args[e.Key] = positive_given
+		}
+		a.sources[e.Key] = "argv"
+		return nil
+	}
+
+	// nil if not filled
+	args[e.Key] = nil
+	if err := a.fill(e, args); err != nil {
+		return err
+	}
+	if s, is_string := args[e.Key].(string); is_string {
+		b, err := Parse_bool(s)
+		if err != nil {
+			return fmt.Errorf("%s: invalid bool value from %s: '%s'", e.Key, a.sources[e.Key], s)
+		}
+		args[e.Key] = b
+	}
+	return nil
+}
+
+// last_given returns which of the long options is given last in a.Argv.
+// Abbreviated long options are recognized, as docopt does.
+func (a *Annotated_usage) last_given(options ...string) string {
+	last := ""
+	a.scan_options(a.Argv, func(i int, key string, attached bool) {
+		for _, o := range options {
+			if o == key {
+				last = o
+			}
+		}
+	})
+	return last
+}
+
+// long_option returns the long option abbreviated by prefix, prefix if
+// none or more than one match.
+func (a *Annotated_usage) long_option(prefix string) string {
+	if a.model == nil {
+		return prefix
+	}
+	found := []string{}
+	for _, o := range a.model.Options {
+		if o.Long == prefix {
+			return prefix
+		}
+		if strings.HasPrefix(o.Long, prefix) {
+			found = append(found, o.Long)
+		}
+	}
+	if len(found) == 1 {
+		return found[0]
+	}
+	return prefix
+}
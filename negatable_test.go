@@ -0,0 +1,123 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// unit test for negatable.go
+//
+package main
+
+import (
+	"github.com/docopt/docopt-go"
+	"github.com/docopt/docopts/docopt_engine"
+	"reflect"
+	"testing"
+)
+
+func TestRewrite_negatables(t *testing.T) {
+	doc := `Usage: prog [--[no-]color] [options]
+
+Options: --[no-]pager  Pager
+  --[no-]color  Colorize --[no-]color [default: true]`
+	a, err := Parse_annotations(doc)
+	if err != nil {
+		t.Fatalf("Parse_annotations: %v", err)
+	}
+	expect := `Usage: prog [[--color] [--no-color]] [options]
+
+Options: --pager  Pager
+  --no-pager
+  --color  Colorize --[no-]color 
+  --no-color`
+	if a.Doc != expect {
+		t.Errorf("Parse_annotations(): got Doc %q, want %q", a.Doc, expect)
+	}
+	if a.Help != doc {
+		t.Errorf("Parse_annotations(): got Help %q, want %q", a.Help, doc)
+	}
+
+	for _, bad := range []string{
+		"Usage: prog [options]\n\nOptions:\n  --[no-]color=<when>  Color",
+		"Usage: prog [options]\n\nOptions:\n  --[no-]color  Color [default: auto]",
+	} {
+		if _, err := Parse_annotations(bad); err == nil {
+			t.Errorf("Parse_annotations(%q): no error", bad)
+		}
+	}
+}
+
+func TestFill_negatable(t *testing.T) {
+	doc := `Usage: prog [options]
+
+Options:
+  --[no-]color  Colorize [default: true]
+  --[no-]pager  Pager`
+	tables := []struct {
+		argv   []string
+		args   docopt.Opts
+		expect docopt.Opts
+	}{
+		{[]string{},
+			docopt.Opts{"--color": false, "--no-color": false, "--pager": false, "--no-pager": false},
+			docopt.Opts{"--color": true, "--pager": nil}},
+		{[]string{"--no-color", "--pager"},
+			docopt.Opts{"--color": false, "--no-color": true, "--pager": true, "--no-pager": false},
+			docopt.Opts{"--color": false, "--pager": true}},
+		// the last given wins, abbreviated or not
+		{[]string{"--no-col", "--color", "--pager", "--no-p"},
+			docopt.Opts{"--color": true, "--no-color": true, "--pager": true, "--no-pager": true},
+			docopt.Opts{"--color": true, "--pager": false}},
+		{[]string{"--color", "--no-color", "--", "--color"},
+			docopt.Opts{"--color": true, "--no-color": true, "--pager": false, "--no-pager": false},
+			docopt.Opts{"--color": false, "--pager": nil}},
+	}
+	for _, table := range tables {
+		a, err := Parse_annotations(doc)
+		if err != nil {
+			t.Fatalf("Parse_annotations: %v", err)
+		}
+		a.Argv = table.argv
+		if err := a.Apply(table.args); err != nil {
+			t.Errorf("Apply(%v): %v", table.argv, err)
+			continue
+		}
+		if !reflect.DeepEqual(table.args, table.expect) {
+			t.Errorf("Apply(%v): got %v, want %v", table.argv, table.args, table.expect)
+		}
+	}
+}
+
+func TestNegatable_short_alias(t *testing.T) {
+	a, err := Parse_annotations(`Usage: prog [options]
+
+Options:
+  -c, --[no-]color  Colorize [default: false]`)
+	if err != nil {
+		t.Fatalf("Parse_annotations: %v", err)
+	}
+	if len(a.Elements) != 1 || a.Elements[0].Key != "--color" || !a.Elements[0].Negatable {
+		t.Fatalf("Parse_annotations: got Elements %v", a.Elements)
+	}
+	tables := []struct {
+		argv   []string
+		expect interface{}
+	}{
+		{[]string{}, false},
+		{[]string{"-c"}, true},
+		{[]string{"--no-color"}, false},
+		{[]string{"--no-color", "-c"}, true},
+		{[]string{"-c", "--no-color"}, false},
+	}
+	parser := &docopt_engine.Parser{}
+	for _, table := range tables {
+		args, err := parser.ParseDoc(a.Doc, a.Prepare_argv(table.argv, false), "")
+		if err == nil {
+			err = a.Apply(args)
+		}
+		if err != nil {
+			t.Errorf("%q: %v", table.argv, err)
+			continue
+		}
+		expect := docopt.Opts{"--color": table.expect}
+		if !reflect.DeepEqual(docopt.Opts(args), expect) {
+			t.Errorf("%q: got %v, want %v", table.argv, args, expect)
+		}
+	}
+}
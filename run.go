@@ -0,0 +1,215 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// run.go implements the verb: docopts run, also run as docopts-run
+//
+// docopts is the script interpreter: the "# Usage:" header of the script is
+// parsed, then bash runs the script with the parsed arguments already set,
+// through BASH_ENV:
+//
+//	#!/usr/bin/env -S docopts-run bash
+//	# Usage: prog [-v] <file>...
+//
+//	echo "$v ${file[@]}"
+//
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/docopt/docopt-go"
+	"github.com/docopt/docopts/docopt_engine"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+var Usage_run string = `Run a script with the arguments parsed from its usage header.
+
+Usage:
+  docopts run [-A <name> | -G <prefix>] <shell> <script> [<args>...]
+  docopts run --help
+
+Options:
+  -A <name>    Parsed arguments are stored in a Bash 4+ associative array
+               called <name>.
+  -G <prefix>  Parsed arguments are stored in Bash 3.2 compatible GLOBAL
+               variables: <prefix>_{mangled_args}
+  <shell>      The shell running the script, only bash is supported.
+  <script>     The script, its help is found as docopt_get_help_string and
+               its version as docopt_get_version_string do in docopts.sh.
+
+Installed as docopts-run (a link to docopts), it is a script interpreter:
+  #!/usr/bin/env -S docopts-run bash
+The help, the version and the usage errors are handled before the shell
+starts, with the exit code 0 or 64. The parsed arguments are set by a
+temporary file given to bash as BASH_ENV, the file removes itself.
+`
+
+func init() {
+	verbs["run"] = Verb_run
+}
+
+func Verb_run(argv []string) int {
+	// a shebang gives its arguments as one word on Linux: docopts-run "-A ARGS bash"
+	if len(argv) > 1 && strings.ContainsAny(argv[1], " \t") {
+		argv = append(append([]string{argv[0]}, strings.Fields(argv[1])...), argv[2:]...)
+	}
+
+	// the script arguments may contain anything, they are split manually
+	// after docopts's own options, the shell and the script
+	i := 1
+	for i < len(argv) && strings.HasPrefix(argv[i], "-") {
+		if argv[i] == "-A" || argv[i] == "-G" {
+			i++
+		}
+		i++
+	}
+	own_argv := argv
+	if i+2 <= len(argv) {
+		own_argv = argv[:i+2]
+	}
+	arguments := Parse_verb_args(Usage_run, own_argv)
+	script_args := argv[len(own_argv):]
+
+	shell := arguments["<shell>"].(string)
+	if filepath.Base(shell) != "bash" {
+		docopts_error("run: unsupported shell: %s", fmt.Errorf("%s", shell))
+	}
+	script := arguments["<script>"].(string)
+	content, err := ioutil.ReadFile(script)
+	if err != nil {
+		docopts_error("run: %v", err)
+	}
+	doc := Script_help_string(string(content))
+	if doc == "" {
+		docopts_error("run: %v", fmt.Errorf("'# Usage:' not found in %s", script))
+	}
+
+	annotated, err := Parse_annotations(doc)
+	if err != nil {
+		docopts_error("run: %v", err)
+	}
+	exit_code := -1
+	parser := &docopt_engine.Parser{HelpHandler: annotated.Help_handler(Direct_help_handler(&exit_code))}
+	args, err := annotated.Parse_argv(parser, script_args, Script_version_string(string(content)))
+	if exit_code >= 0 {
+		return exit_code
+	}
+	if err != nil {
+		docopts_error("run: %v", err)
+	}
+	for _, warning := range annotated.Warnings {
+		fmt.Fprintln(os.Stderr, warning)
+	}
+
+	d := &Docopts{
+		Global_prefix:  "",
+		Mangle_key:     true,
+		Output_declare: true,
+	}
+	if prefix, err := arguments.String("-G"); err == nil {
+		d.Global_prefix = prefix
+	}
+	bash_assoc, _ := arguments.String("-A")
+	if arguments["-A"] != nil && !IsBashIdentifier(bash_assoc) {
+		docopts_error("-A: not a valid Bash identifier: '%s'", fmt.Errorf("%s", bash_assoc))
+	}
+
+	bash_env, err := d.Write_bash_env(args, bash_assoc, os.Getenv("BASH_ENV"))
+	if err != nil {
+		docopts_error("run: %v", err)
+	}
+	path, err := exec.LookPath(shell)
+	if err == nil {
+		os.Setenv("BASH_ENV", bash_env)
+		err = Exec_command(path, append([]string{shell, script}, script_args...))
+	}
+	os.Remove(bash_env)
+	fmt.Fprintf(os.Stderr, "docopts:error: run: %v\n", err)
+	return 127
+}
+
+// Write_bash_env writes the bash code of args to a temporary file to be given
+// as BASH_ENV, the code removes the file then restores the previous BASH_ENV.
+// If bash_assoc is not empty the -A mode is used, else global variables.
+func (d *Docopts) Write_bash_env(args docopt.Opts, bash_assoc string, previous_bash_env string) (string, error) {
+	f, err := ioutil.TempFile("", "docopts-run-")
+	if err != nil {
+		return "", err
+	}
+
+	var code bytes.Buffer
+	d.Output = &code
+	if bash_assoc != "" {
+		d.Print_bash_args(bash_assoc, args)
+	} else {
+		err = d.Print_bash_global(args)
+	}
+	fmt.Fprintf(&code, "rm -f '%s'\n", Shellquote(f.Name()))
+	if previous_bash_env != "" {
+		fmt.Fprintf(&code, "BASH_ENV='%s'\n. \"$BASH_ENV\"\n", Shellquote(previous_bash_env))
+	} else {
+		code.WriteString("unset BASH_ENV\n")
+	}
+
+	if err == nil {
+		_, err = f.Write(code.Bytes())
+	}
+	if close_err := f.Close(); err == nil {
+		err = close_err
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// Script_help_string returns the first block of comment starting at
+// "# Usage:" and ending at an empty line, as docopt_get_help_string.
+func Script_help_string(content string) string {
+	usage := []string{}
+	found := false
+	for _, line := range strings.Split(content, "\n") {
+		if !found && !strings.HasPrefix(line, "# Usage:") {
+			continue
+		}
+		found = true
+		usage = append(usage, uncomment(line))
+		if line == "" {
+			break
+		}
+	}
+	return strings.TrimSpace(strings.Join(usage, "\n"))
+}
+
+// Script_version_string returns the comment blocks starting at "# ----" and
+// ending at an empty line, as docopt_get_version_string.
+func Script_version_string(content string) string {
+	version := []string{}
+	in_block := false
+	for _, line := range strings.Split(content, "\n") {
+		if !in_block {
+			in_block = strings.HasPrefix(line, "# ----")
+			continue
+		}
+		if line == "" {
+			in_block = false
+			continue
+		}
+		if line = uncomment(line); !strings.Contains(line, "----") {
+			version = append(version, line)
+		}
+	}
+	return strings.TrimSpace(strings.Join(version, "\n"))
+}
+
+// one level of comment markup is removed
+func uncomment(line string) string {
+	if strings.HasPrefix(line, "# ") {
+		return line[2:]
+	}
+	return strings.TrimPrefix(line, "#")
+}
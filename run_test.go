@@ -0,0 +1,90 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// unit test for run.go
+//
+package main
+
+import (
+	"github.com/docopt/docopt-go"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+const run_script = `#!/usr/bin/env -S docopts-run bash
+#
+# Usage: prog [-v] <file>...
+#        prog --version
+#
+# Options:
+#   -v  verbose
+#
+#Comment without space
+
+# ----
+# prog 1.0
+# Copyright (C) 2026
+# ----
+
+echo "$v"
+`
+
+func TestScript_help_string(t *testing.T) {
+	tables := []struct {
+		content string
+		expect  string
+	}{
+		{run_script, "Usage: prog [-v] <file>...\n       prog --version\n\nOptions:\n  -v  verbose\n\nComment without space"},
+		{"# Usage: prog\necho\n\n# Usage: other", "Usage: prog\necho"},
+		{"#!/bin/bash\n# usage: prog\n", ""},
+	}
+	for _, table := range tables {
+		if got := Script_help_string(table.content); got != table.expect {
+			t.Errorf("Script_help_string(%q): got %q, want %q", table.content, got, table.expect)
+		}
+	}
+}
+
+func TestScript_version_string(t *testing.T) {
+	tables := []struct {
+		content string
+		expect  string
+	}{
+		{run_script, "prog 1.0\nCopyright (C) 2026"},
+		{"# Usage: prog\n", ""},
+	}
+	for _, table := range tables {
+		if got := Script_version_string(table.content); got != table.expect {
+			t.Errorf("Script_version_string(%q): got %q, want %q", table.content, got, table.expect)
+		}
+	}
+}
+
+func TestWrite_bash_env(t *testing.T) {
+	args := docopt.Opts{"-v": true, "<file>": []string{"a"}}
+	tables := []struct {
+		bash_assoc string
+		previous   string
+		expect     []string
+	}{
+		{"", "", []string{"v=true\n", "file=('a')\n", "unset BASH_ENV\n"}},
+		{"ARGS", "/etc/bash env", []string{"declare -A ARGS\n", "BASH_ENV='/etc/bash env'\n. \"$BASH_ENV\"\n"}},
+	}
+	for _, table := range tables {
+		d := &Docopts{Mangle_key: true, Output_declare: true}
+		path, err := d.Write_bash_env(args, table.bash_assoc, table.previous)
+		if err != nil {
+			t.Errorf("Write_bash_env(%q): %v", table.bash_assoc, err)
+			continue
+		}
+		content, _ := ioutil.ReadFile(path)
+		os.Remove(path)
+		code := string(content)
+		for _, e := range append(table.expect, "rm -f '"+path+"'\n") {
+			if !strings.Contains(code, e) {
+				t.Errorf("Write_bash_env(%q): %q not found in:\n%s", table.bash_assoc, e, code)
+			}
+		}
+	}
+}
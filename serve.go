@@ -0,0 +1,314 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// serve.go implements the verb: docopts serve
+//
+// The server runs docopts's legacy command line for each request, so scripts
+// calling docopts many times don't start a new process for each call. The
+// usage messages are compiled once by docopt_engine and kept in memory.
+//
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+var Usage_serve string = `Serve parse requests on a unix socket or on standard input.
+
+Usage:
+  docopts serve --socket=<path>
+  docopts serve --stdio
+  docopts serve --help
+
+Options:
+  --socket=<path>  Listen on the unix socket <path>, requests are served
+                   concurrently. The client is: docopts --connect=<path> ...
+  --stdio          Read requests on standard input and write responses on
+                   standard output, for a bash coprocess: see
+                   docopt_coproc_start in docopts.sh.
+
+A request is the docopts command line, as given to docopts, followed by the
+content of standard input, the environment of the client, read by
+[env: NAME], and its current directory, relative paths are relative to it.
+Each field ends with a NUL byte:
+  <count of arguments> NUL <argument> NUL ... <stdin> NUL
+  <count of variables> NUL <NAME=value> NUL ... <current directory> NUL
+The response is the exit code, the standard output and the standard error:
+  <exit code> NUL <stdout> NUL <stderr> NUL
+A malformed request is answered with the exit code 1 and the error, then the
+connection is closed.
+Compiled usage messages are kept in memory between requests.
+`
+
+func init() {
+	verbs["serve"] = Verb_serve
+	Register_flag("--connect")
+}
+
+func Verb_serve(argv []string) int {
+	arguments := Parse_verb_args(Usage_serve, argv)
+	cache := New_usage_cache()
+
+	if arguments["--stdio"].(bool) {
+		err := cache.Serve(struct {
+			io.Reader
+			io.Writer
+		}{os.Stdin, os.Stdout})
+		if err != nil {
+			docopts_error("serve: %v", err)
+		}
+		return 0
+	}
+
+	socket := arguments["--socket"].(string)
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		docopts_error("serve: %v", err)
+	}
+	// remove the socket on exit
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		listener.Close()
+	}()
+
+	cache.Listen(listener)
+	return 0
+}
+
+// Listen serves each connection of listener in its own goroutine, until
+// listener is closed.
+func (c *Usage_cache) Listen(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			// a connection must not stop the server
+			defer func() {
+				if p := recover(); p != nil {
+					fmt.Fprintf(os.Stderr, "docopts:error: serve: panic: %v\n", p)
+				}
+			}()
+			err := c.Serve(conn)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "docopts:error: serve: %v\n", err)
+			}
+		}()
+	}
+}
+
+// Serve answers the requests read on conn until end of file. A malformed
+// request is answered with its error, the next requests cannot be read.
+func (c *Usage_cache) Serve(conn io.ReadWriter) error {
+	reader := bufio.NewReader(conn)
+	for {
+		req, err := Read_request(reader)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			Write_response(conn, 1, "", fmt.Sprintf("docopts:error: serve: %v\n", err))
+			return err
+		}
+		exit_code, stdout, stderr := c.Run(req)
+		err = Write_response(conn, exit_code, stdout, stderr)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Run is Docopts_run.Run() for a request, with the output captured. A panic
+// is reported as the one-shot docopts would: exit code 2.
+func (c *Usage_cache) Run(req *Request) (exit_code int, stdout string, stderr string) {
+	var o, e bytes.Buffer
+	defer func() {
+		if p := recover(); p != nil {
+			fmt.Fprintf(&e, "panic: %v\n", p)
+			exit_code, stdout, stderr = 2, o.String(), e.String()
+		}
+	}()
+
+	r := &Docopts_run{
+		Stdin:  strings.NewReader(req.Stdin),
+		Stdout: &o,
+		Stderr: &e,
+		Cache:  c,
+		Env:    req.Env,
+		Dir:    req.Dir,
+	}
+	exit_code = r.Run(req.Args)
+	return exit_code, o.String(), e.String()
+}
+
+// Connect sends args, our environment and current directory to the server
+// listening on socket.
+// The standard input is sent only if with_stdin. The server's output and exit
+// code are ours.
+func (r *Docopts_run) Connect(socket string, args []string, with_stdin bool) int {
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		fmt.Fprintf(r.Stderr, "docopts:error: connect: %v\n", err)
+		return 1
+	}
+	defer conn.Close()
+
+	stdin := ""
+	if with_stdin {
+		bytes, _ := ioutil.ReadAll(r.Stdin)
+		stdin = string(bytes)
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintf(r.Stderr, "docopts:error: connect: %v\n", err)
+		return 1
+	}
+	err = Write_request(conn, &Request{Args: args, Stdin: stdin, Env: os.Environ(), Dir: dir})
+	if err != nil {
+		fmt.Fprintf(r.Stderr, "docopts:error: connect: %v\n", err)
+		return 1
+	}
+	exit_code, stdout, stderr, err := Read_response(bufio.NewReader(conn))
+	if err != nil {
+		fmt.Fprintf(r.Stderr, "docopts:error: connect: %v\n", err)
+		return 1
+	}
+	fmt.Fprint(r.Stdout, stdout)
+	fmt.Fprint(r.Stderr, stderr)
+	return exit_code
+}
+
+// protocol fields end with a NUL byte, they cannot contain one
+func write_fields(w io.Writer, fields ...string) error {
+	var buf bytes.Buffer
+	for _, f := range fields {
+		if strings.IndexByte(f, 0) >= 0 {
+			return fmt.Errorf("NUL byte not supported: %q", f)
+		}
+		buf.WriteString(f)
+		buf.WriteByte(0)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func read_field(r *bufio.Reader) (string, error) {
+	field, err := r.ReadString(0)
+	if err == io.EOF && field != "" {
+		return "", io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return "", err
+	}
+	return field[:len(field)-1], nil
+}
+
+func read_int(r *bufio.Reader) (int, error) {
+	field, err := read_field(r)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(field)
+}
+
+// A Request is a docopts command line run by the server for a client.
+type Request struct {
+	Args  []string
+	Stdin string
+	// the environment of the client: NAME=value
+	Env []string
+	// the current directory of the client
+	Dir string
+}
+
+// Max_request_args is the maximum count of arguments, or of variables, of a
+// request.
+const Max_request_args = 1 << 20
+
+func Write_request(w io.Writer, req *Request) error {
+	fields := append([]string{strconv.Itoa(len(req.Args))}, req.Args...)
+	fields = append(fields, req.Stdin, strconv.Itoa(len(req.Env)))
+	fields = append(fields, req.Env...)
+	return write_fields(w, append(fields, req.Dir)...)
+}
+
+// Read_request returns io.EOF if there is no more request.
+func Read_request(r *bufio.Reader) (*Request, error) {
+	field, err := read_field(r)
+	if err != nil {
+		return nil, err
+	}
+	req := &Request{}
+	if req.Args, err = read_list(r, field, "arguments"); err != nil {
+		return nil, err
+	}
+	if req.Stdin, err = read_field(r); err != nil {
+		return nil, unexpected_eof(err)
+	}
+	if field, err = read_field(r); err != nil {
+		return nil, unexpected_eof(err)
+	}
+	if req.Env, err = read_list(r, field, "variables"); err != nil {
+		return nil, err
+	}
+	if req.Dir, err = read_field(r); err != nil {
+		return nil, unexpected_eof(err)
+	}
+	return req, nil
+}
+
+// read_list reads the fields of a list, count is the field read before.
+func read_list(r *bufio.Reader, count string, name string) ([]string, error) {
+	n, err := strconv.Atoi(count)
+	if err != nil || n < 0 || n > Max_request_args {
+		return nil, fmt.Errorf("protocol error: invalid count of %s: '%s', the maximum is %d", name, count, Max_request_args)
+	}
+	// the fields are not allocated before they are read
+	list := []string{}
+	for i := 0; i < n; i++ {
+		field, err := read_field(r)
+		if err != nil {
+			return nil, unexpected_eof(err)
+		}
+		list = append(list, field)
+	}
+	return list, nil
+}
+
+func Write_response(w io.Writer, exit_code int, stdout string, stderr string) error {
+	return write_fields(w, strconv.Itoa(exit_code), stdout, stderr)
+}
+
+func Read_response(r *bufio.Reader) (exit_code int, stdout string, stderr string, err error) {
+	if exit_code, err = read_int(r); err != nil {
+		return 0, "", "", unexpected_eof(err)
+	}
+	if stdout, err = read_field(r); err != nil {
+		return 0, "", "", unexpected_eof(err)
+	}
+	if stderr, err = read_field(r); err != nil {
+		return 0, "", "", unexpected_eof(err)
+	}
+	return exit_code, stdout, stderr, nil
+}
+
+// inside a request or a response, end of file is an error
+func unexpected_eof(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,202 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// unit test for serve.go
+//
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var serve_tests = []struct {
+	args  []string
+	stdin string
+}{
+	{[]string{"-h", naval_fate, ":", "ship", "new", "foo", "bar"}, ""},
+	{[]string{"-A", "args", "-h", naval_fate, ":", "mine", "set", "1", "2"}, ""},
+	{[]string{"-G", "ARGS", "-h", naval_fate, ":", "ship", "Guardian", "move", "1", "2", "--speed=5"}, ""},
+	{[]string{"--no-mangle", "-h", naval_fate, ":", "--version"}, ""},
+	{[]string{"-V", "1.0", "-h", naval_fate, ":", "--version"}, ""},
+	{[]string{"-h", naval_fate, ":", "--help"}, ""},
+	{[]string{"-h", naval_fate, ":", "ship"}, ""},
+	{[]string{"-h", "-", ":", "-a"}, "Usage: prog [-a]"},
+	{[]string{"--debug", "-h", "Usage: prog <file>", ":", "f"}, ""},
+	{[]string{"-h", "Usage: prog --long-option <long-option>", ":", "--long-option", "a"}, ""},
+	{[]string{"-A", "1bad", "-h", "Usage: prog", ":"}, ""},
+	{[]string{"--help"}, ""},
+	{[]string{"--bad-option"}, ""},
+	{[]string{"-h", "Usage: prog", ":"}, ""},
+}
+
+func TestUsage_cache_Run(t *testing.T) {
+	c := New_usage_cache()
+	// twice: compiled usages are reused
+	for i := 0; i < 2; i++ {
+		for _, table := range serve_tests {
+			var stdout, stderr bytes.Buffer
+			r := &Docopts_run{
+				Stdin:  strings.NewReader(table.stdin),
+				Stdout: &stdout,
+				Stderr: &stderr,
+			}
+			expect := r.Run(table.args)
+
+			exit_code, o, e := c.Run(&Request{Args: table.args, Stdin: table.stdin})
+			if exit_code != expect || o != stdout.String() || e != stderr.String() {
+				t.Errorf("Usage_cache.Run %v\ngot: %d '%s' '%s'\nwant: %d '%s' '%s'", table.args,
+					exit_code, o, e, expect, stdout.String(), stderr.String())
+			}
+		}
+	}
+
+	// an invalid usage panics in one-shot mode
+	exit_code, _, e := c.Run(&Request{Args: []string{"-h", "Usage: prog (", ":"}})
+	if exit_code != 2 || !strings.HasPrefix(e, "panic: ") {
+		t.Errorf("Usage_cache.Run invalid usage got: %d '%s'", exit_code, e)
+	}
+
+	// [env: NAME] is read in the environment of the client
+	os.Setenv("TEST_DOCOPTS_SERVE", "server")
+	defer os.Unsetenv("TEST_DOCOPTS_SERVE")
+	doc := "Usage: prog [--name=<n>]\n\nOptions:\n  --name=<n>  [env: TEST_DOCOPTS_SERVE]"
+	for _, env := range [][]string{{"TEST_DOCOPTS_SERVE=client"}, {}} {
+		exit_code, o, e := c.Run(&Request{Args: []string{"-h", doc, ":"}, Env: env})
+		expect := "name=\n"
+		if len(env) > 0 {
+			expect = "name='client'\n"
+		}
+		if exit_code != 0 || o != expect {
+			t.Errorf("Usage_cache.Run env %q got: %d '%s' '%s', want: '%s'", env, exit_code, o, e, expect)
+		}
+	}
+
+	// relative paths are relative to the current directory of the client
+	dir, err := ioutil.TempDir("", "docopts-serve-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "file.txt"), []byte("content"), 0644)
+	doc = "Usage: prog <file>\n\nOptions:\n  <file>  [path: file,exists,absolute]"
+	exit_code, o, e := c.Run(&Request{Args: []string{"-h", doc, ":", "file.txt"}, Dir: dir})
+	if expect := "file='" + filepath.Join(dir, "file.txt") + "'\n"; exit_code != 0 || o != expect {
+		t.Errorf("Usage_cache.Run dir %s got: %d '%s' '%s', want: '%s'", dir, exit_code, o, e, expect)
+	}
+}
+
+func TestRead_request(t *testing.T) {
+	tables := [][]string{
+		{},
+		{""},
+		{"-h", "Usage: prog\n  prog <file>", ":", "a b", ""},
+	}
+	for _, args := range tables {
+		var buf bytes.Buffer
+		req := &Request{Args: args, Stdin: "stdin\ncontent", Env: []string{"HOME=/home/user", "A="}, Dir: "/tmp"}
+		if err := Write_request(&buf, req); err != nil {
+			t.Errorf("Write_request error: %v", err)
+		}
+		// truncated requests
+		data := buf.Bytes()
+		for i := 1; i < len(data); i++ {
+			_, err := Read_request(bufio.NewReader(bytes.NewReader(data[:i])))
+			if err == nil || err == io.EOF {
+				t.Errorf("Read_request truncated %q: expecting error, got: %v", data[:i], err)
+			}
+		}
+
+		reader := bufio.NewReader(&buf)
+		got, err := Read_request(reader)
+		if err != nil || !reflect.DeepEqual(got, req) {
+			t.Errorf("Read_request got: %+v %v, want: %+v", got, err, req)
+		}
+		_, err = Read_request(reader)
+		if err != io.EOF {
+			t.Errorf("Read_request expecting EOF, got: %v", err)
+		}
+	}
+
+	if err := Write_request(new(bytes.Buffer), &Request{Args: []string{"a\x00b"}}); err == nil {
+		t.Errorf("Write_request expecting error on NUL byte")
+	}
+	for _, count := range []string{"-1", "99999999999999999", "1048577", "a"} {
+		_, err := Read_request(bufio.NewReader(strings.NewReader(count + "\x00")))
+		if err == nil || !strings.HasPrefix(err.Error(), "protocol error:") {
+			t.Errorf("Read_request count %s: expecting protocol error, got: %v", count, err)
+		}
+	}
+}
+
+func TestUsage_cache_Serve(t *testing.T) {
+	var output bytes.Buffer
+	conn := struct {
+		io.Reader
+		io.Writer
+	}{strings.NewReader("99999999999999999\x00"), &output}
+	err := New_usage_cache().Serve(conn)
+	if err == nil {
+		t.Errorf("Serve expecting error on invalid count")
+	}
+	exit_code, stdout, stderr, err := Read_response(bufio.NewReader(&output))
+	if err != nil || exit_code != 1 || stdout != "" || !strings.Contains(stderr, "protocol error:") {
+		t.Errorf("Serve invalid count got: %d '%s' '%s' %v", exit_code, stdout, stderr, err)
+	}
+}
+
+func TestConnect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docopts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "docopts.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go New_usage_cache().Listen(listener)
+
+	for _, table := range serve_tests {
+		var stdout, stderr bytes.Buffer
+		r := &Docopts_run{
+			Stdin:  strings.NewReader(table.stdin),
+			Stdout: &stdout,
+			Stderr: &stderr,
+		}
+		expect := r.Run(table.args)
+		want_o, want_e := stdout.String(), stderr.String()
+
+		switch table.args[0] {
+		case "--bad-option", "--help", "--debug":
+			// not a parse request, the client answers itself, or debug
+			// output showing --connect
+			continue
+		}
+		stdout.Reset()
+		stderr.Reset()
+		r.Stdin = strings.NewReader(table.stdin)
+		args := append([]string{"--connect", socket}, table.args...)
+		exit_code := r.Run(args)
+		if exit_code != expect || stdout.String() != want_o || stderr.String() != want_e {
+			t.Errorf("Connect %v\ngot: %d '%s' '%s'\nwant: %d '%s' '%s'", table.args,
+				exit_code, stdout.String(), stderr.String(), expect, want_o, want_e)
+		}
+	}
+
+	var stderr bytes.Buffer
+	r := &Docopts_run{Stdout: new(bytes.Buffer), Stderr: &stderr}
+	exit_code := r.Run([]string{"--connect", filepath.Join(dir, "none"), "-h", "Usage: prog", ":"})
+	if exit_code != 1 || !strings.Contains(stderr.String(), "docopts:error: connect:") {
+		t.Errorf("Connect without server got: %d '%s'", exit_code, stderr.String())
+	}
+}
@@ -0,0 +1,212 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// skeleton.go implements the verb: docopts skeleton
+//
+// It outputs a ready-to-edit script from a docopt usage string: the usage is
+// embedded as a "# Usage:" comment so docopt_get_help_string() (and
+// docopts.sh --auto) can find it back.
+//
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+var Usage_skeleton string = `Output a ready-to-edit script for the given usage message.
+
+Usage:
+  docopts skeleton [--shell=<name>] [-A <name> | -G <prefix>] <msg>
+  docopts skeleton --help
+
+Options:
+  --shell=<name>  Shell of the generated script, only bash is supported.
+                  [default: bash]
+  -A <name>       Parsed arguments are stored in a Bash 4+ associative array
+                  called <name>.
+  -G <prefix>     Parsed arguments are stored in Bash 3.2 compatible GLOBAL
+                  variables: <prefix>_{mangled_args}
+  <msg>           The usage message in docopt format. If - is given, read the
+                  usage message from standard input.
+`
+
+func init() {
+	verbs["skeleton"] = Verb_skeleton
+}
+
+func Verb_skeleton(argv []string) int {
+	arguments := Parse_verb_args(Usage_skeleton, argv)
+
+	shell := arguments["--shell"].(string)
+	if shell != "bash" {
+		docopts_error("skeleton: unsupported shell: %s", fmt.Errorf("%s", shell))
+	}
+
+	d := &Docopts{
+		Global_prefix:  "",
+		Mangle_key:     true,
+		Output_declare: true,
+	}
+	assoc, err := arguments.String("-A")
+	if err == nil {
+		if !IsBashIdentifier(assoc) {
+			docopts_error("-A: not a valid Bash identifier: '%s'", fmt.Errorf("%s", assoc))
+		}
+	}
+	global_prefix, err := arguments.String("-G")
+	if err == nil {
+		d.Global_prefix = global_prefix
+	}
+
+	err = d.Print_skeleton(Read_msg(arguments["<msg>"].(string)), assoc)
+	if err != nil {
+		docopts_error("skeleton: %v", err)
+	}
+	return 0
+}
+
+// Print_skeleton outputs a bash script parsing its arguments with docopts.
+// If bash_assoc is not empty the -A mode is used, else global variables are
+// named following Docopts.Name_mangle().
+func (d *Docopts) Print_skeleton(doc string, bash_assoc string) error {
+	m, err := Parse_annotated_usage(doc)
+	if err != nil {
+		return err
+	}
+
+	// variable reference for each parsed key, same rules as Print_bash_global
+	refs := make(map[string]string)
+	keys := []string{}
+	for _, key := range m.Leaves() {
+		if bash_assoc != "" {
+			refs[key] = fmt.Sprintf("${%s[%s]}", bash_assoc, key)
+		} else {
+			if key == "--" && d.Global_prefix == "" {
+				continue
+			}
+			name, err := d.Name_mangle(key)
+			if err != nil {
+				return err
+			}
+			refs[key] = "$" + name
+		}
+		keys = append(keys, key)
+	}
+	if bash_assoc == "" {
+		seen := make(map[string]string)
+		for _, key := range keys {
+			if prev_key, found := seen[refs[key]]; found {
+				return fmt.Errorf("%s: two or more elements have identically mangled names", prev_key)
+			}
+			seen[refs[key]] = key
+		}
+	}
+
+	script := "#!/usr/bin/env bash\n#\n"
+	for _, line := range strings.Split(doc, "\n") {
+		script += strings.TrimRight("# "+line, " ") + "\n"
+	}
+	// docopt_get_help_string() stops at the first empty line
+	script += "\n"
+
+	docopts_args := ""
+	if bash_assoc != "" {
+		docopts_args = fmt.Sprintf(" -A %s", bash_assoc)
+	} else if d.Global_prefix != "" {
+		docopts_args = fmt.Sprintf(" -G %s", d.Global_prefix)
+	}
+	script += "# docopts and docopts.sh are expected in $PATH\n"
+	script += "source docopts.sh\n"
+	script += "usage=$(docopt_get_help_string \"$0\")\n"
+	if _, found := refs["--version"]; found {
+		script += fmt.Sprintf("version='%s 0.1.0'\n", Shellquote(m.Prog))
+		docopts_args += ` -V "$version"`
+	}
+	script += fmt.Sprintf("eval \"$(docopts%s -h \"$usage\" : \"$@\")\"\n", docopts_args)
+
+	// arrays are referenced as a whole
+	display := make(map[string]string)
+	width := 0
+	for _, key := range keys {
+		display[key] = refs[key]
+		if m.describe_leaf(key) == "array" {
+			if bash_assoc != "" {
+				display[key] = fmt.Sprintf("${%s[%s,#]}", bash_assoc, key)
+			} else {
+				display[key] = fmt.Sprintf("\"${%s[@]}\"", refs[key][1:])
+			}
+		}
+		if len(display[key]) > width {
+			width = len(display[key])
+		}
+	}
+	script += "\n# parsed arguments:\n"
+	for _, key := range keys {
+		script += fmt.Sprintf("#   %-*s  %s\n", width, display[key], m.describe_option(key))
+	}
+
+	paths := m.Command_paths()
+	if len(paths) == 0 {
+		script += "\n# TODO: main code here\n"
+		fmt.Fprint(out, script)
+		return nil
+	}
+
+	script += "\n"
+	for i, path := range paths {
+		conditions := make([]string, len(path))
+		for j, command := range path {
+			if m.Repeated[command] {
+				// repeated command is a counter
+				conditions[j] = fmt.Sprintf("[[ %s -gt 0 ]]", refs[command])
+			} else {
+				conditions[j] = refs[command]
+			}
+		}
+		keyword := "elif"
+		if i == 0 {
+			keyword = "if"
+		}
+		script += fmt.Sprintf("%s %s ; then\n", keyword, strings.Join(conditions, " && "))
+		script += fmt.Sprintf("    # TODO: %s %s\n    :\n", m.Prog, strings.Join(path, " "))
+	}
+	script += "fi\n"
+
+	fmt.Fprint(out, script)
+	return nil
+}
+
+// describe_leaf gives the type of the value of a parsed key: boolean,
+// counter, string or array.
+func (m *Usage_model) describe_leaf(key string) string {
+	repeated := m.Repeated[key]
+	takes_value := m.Leaf_kind(key) == Pattern_argument
+	o := m.Find_option(key)
+	if o != nil && o.Argcount > 0 {
+		takes_value = true
+	}
+
+	switch {
+	case repeated && takes_value:
+		return "array"
+	case repeated:
+		return "counter"
+	case takes_value:
+		return "string"
+	}
+	return "boolean"
+}
+
+// describe_option is describe_leaf with the option argument and default.
+func (m *Usage_model) describe_option(key string) string {
+	desc := key
+	o := m.Find_option(key)
+	if o != nil && o.Argcount > 0 && o.Arg_name != "" {
+		desc = fmt.Sprintf("%s=%s", key, o.Arg_name)
+	}
+	desc = fmt.Sprintf("%s %s", desc, m.describe_leaf(key))
+	if o != nil && o.Has_default {
+		desc += fmt.Sprintf(" [default: %s]", o.Default)
+	}
+	return desc
+}
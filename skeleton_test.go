@@ -0,0 +1,99 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// unit test for skeleton.go
+//
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPrint_skeleton(t *testing.T) {
+	// replace out (os.Stdout) by a buffer
+	bak := out
+	out = new(bytes.Buffer)
+	defer func() { out = bak }()
+
+	tables := []struct {
+		prefix string
+		assoc  string
+		expect []string
+	}{
+		{
+			"", "",
+			[]string{
+				"#!/usr/bin/env bash\n#\n# Naval Fate.\n#\n# Usage:\n#   naval_fate.py ship new <name>...\n",
+				"#   --drifting    Drifting mine.\n\n",
+				"version='naval_fate.py 0.1.0'\n",
+				`eval "$(docopts -V "$version" -h "$usage" : "$@")"`,
+				"#   $speed        --speed=<kn> string [default: 10]\n",
+				"#   \"${name[@]}\"  <name> array\n",
+				"#   $help         --help boolean\n",
+				"if $ship && $new ; then\n",
+				"elif $mine && $remove ; then\n",
+			},
+		},
+		{
+			"ARGS", "",
+			[]string{
+				`eval "$(docopts -G ARGS -V "$version" -h "$usage" : "$@")"`,
+				"if $ARGS_ship && $ARGS_new ; then\n",
+			},
+		},
+		{
+			"", "opts",
+			[]string{
+				`eval "$(docopts -A opts -V "$version" -h "$usage" : "$@")"`,
+				"#   ${opts[<name>,#]}    <name> array\n",
+				"if ${opts[ship]} && ${opts[new]} ; then\n",
+			},
+		},
+	}
+
+	for _, table := range tables {
+		d := &Docopts{
+			Global_prefix: table.prefix,
+			Mangle_key:    true,
+		}
+		err := d.Print_skeleton(strings.TrimSpace(naval_fate), table.assoc)
+		if err != nil {
+			t.Errorf("Print_skeleton error: %v", err)
+		}
+		res := out.(*bytes.Buffer).String()
+		for _, e := range table.expect {
+			if !strings.Contains(res, e) {
+				t.Errorf("Print_skeleton prefix '%s' assoc '%s'\nwant: '%s'\nin: '%s'", table.prefix, table.assoc, e, res)
+			}
+		}
+		out.(*bytes.Buffer).Reset()
+	}
+
+	// the usage given to docopt, --no-color is not output
+	err := (&Docopts{Mangle_key: true}).Print_skeleton(extended_syntax, "")
+	res := out.(*bytes.Buffer).String()
+	if err != nil || !strings.Contains(res, "#   $color  --color boolean\n") || strings.Contains(res, "no_color") {
+		t.Errorf("Print_skeleton for '%s'\ngot: '%s', err: %v", extended_syntax, res, err)
+	}
+	out.(*bytes.Buffer).Reset()
+
+	// mangling errors are the same as Print_bash_global
+	d := &Docopts{Mangle_key: true}
+	err = d.Print_skeleton("Usage: prog --long-option <long-option>", "")
+	if err == nil {
+		t.Errorf("Print_skeleton expecting err on duplicate Mangle_key options")
+	}
+	err = d.Print_skeleton("Usage: prog -9", "")
+	if err == nil {
+		t.Errorf("Print_skeleton expecting err on unmangleable option")
+	}
+	out.(*bytes.Buffer).Reset()
+
+	// without command, no dispatch is generated
+	err = d.Print_skeleton("Usage: prog <file>", "")
+	res = out.(*bytes.Buffer).String()
+	if err != nil || strings.Contains(res, "if ") || !strings.Contains(res, "# TODO: main code here") {
+		t.Errorf("Print_skeleton without command got: '%s', err: %v", res, err)
+	}
+}
@@ -253,3 +253,79 @@ EOF
     [[ ${lines[1]} == 'ARGS_TEXT=some_text' ]]
     rm $tmp
 }
+
+@test "docopt_coproc" {
+    PATH="$(cd .. && pwd):$PATH"
+    docopt_coproc_start
+    usage='Usage: prog [-v] <file>...'
+    run docopt_coproc -G ARGS -h "$usage" : -v a b
+    echo "$output"
+    [[ $status -eq 0 ]]
+    [[ "$output" == "$(docopts -G ARGS -h "$usage" : -v a b)" ]]
+
+    run docopt_coproc -G ARGS -h "$usage" :
+    [[ $status -eq 1 ]]
+    [[ "${lines[-1]}" == 'exit 64' ]]
+
+    # [env: NAME] is read in the environment of the script, not the server's
+    usage='Usage: prog [--name=<n>]
+
+Options:
+  --name=<n>  [env: TEST_DOCOPTS_NAME]'
+    export TEST_DOCOPTS_NAME=script
+    run docopt_coproc -G ARGS -h "$usage" :
+    [[ "$output" == "ARGS_name='script'" ]]
+    unset TEST_DOCOPTS_NAME
+
+    # a relative path is relative to the current directory of the script
+    usage='Usage: prog <file>
+
+Options:
+  <file>  [path: file,exists,absolute]'
+    run docopt_coproc -G ARGS -h "$usage" : docopts.bats
+    [[ "$output" == "ARGS_file='$PWD/docopts.bats'" ]]
+    kill $DOCOPT_COPROC_PID
+}
+
+@test "docopts.sh is sourced by a shell without coproc" {
+    PATH="$(cd .. && pwd):$PATH"
+    tmp=./tmp_docopts_without_coproc
+    # coproc is not a keyword of bash 3.2: an alias makes it a syntax error
+    cat <<'EOF' > $tmp
+#!/usr/bin/env bash
+# Usage: prog <name>
+
+shopt -s expand_aliases
+alias coproc='(('
+source ../docopts.sh --auto -G "$@"
+echo "name=$ARGS_name"
+EOF
+    run bash $tmp world
+    echo "$output"
+    [[ $status -eq 0 ]]
+    [[ "${lines[-1]}" == 'name=world' ]]
+    rm -f $tmp
+}
+
+@test "docopt_check_lib with a docopts without lib verb" {
+    tmp=./tmp_docopt_check_lib
+    mkdir -p $tmp
+    # an older docopts outputs its usage on a usage error
+    cat <<'EOF' > $tmp/docopts
+#!/usr/bin/env bash
+echo "echo 'error: no argument"
+echo "Usage: docopts [options] -h <msg> : [<argv>...]' >&2"
+echo "exit 64"
+exit 1
+EOF
+    chmod +x $tmp/docopts
+    PATH="$tmp:$PATH" run docopt_check_lib ../docopts.sh
+    echo "$output"
+    [[ $status -eq 1 ]]
+    [[ ${#lines[@]} -eq 1 ]]
+    [[ "${lines[0]}" =~ "docopts has no lib verb" ]]
+
+    # stdout is kept clean
+    [[ -z "$(PATH="$tmp:$PATH" docopt_check_lib ../docopts.sh 2>/dev/null)" ]]
+    rm -rf $tmp
+}
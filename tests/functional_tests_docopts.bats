@@ -82,3 +82,424 @@ Usage: prog dump [-]
     [[ "$output" =~ $expected_regexp ]]
     [[ ${#lines[@]} -eq 1 ]]
 }
+
+@test "skeleton outputs a script parsing its own usage" {
+    usage="
+Usage: prog ship new <name>...
+       prog mine (set|remove) <x> [--speed=<kn>]
+
+Options:
+  --speed=<kn>  Speed in knots [default: 10].
+"
+    tmp=./tmp_skeleton.sh
+    run $DOCOPTS_BIN skeleton "$usage"
+    echo "$output"
+    [[ $status -eq 0 ]]
+    echo "$output" > $tmp
+    [[ "${lines[0]}" == '#!/usr/bin/env bash' ]]
+    regexp='if \$ship && \$new ; then'
+    [[ "$output" =~ $regexp ]]
+
+    # the generated script parses its arguments with docopts
+    PATH=..:$PATH run bash $tmp mine set 12 --speed 5
+    echo "$output"
+    [[ $status -eq 0 ]]
+    rm -f $tmp
+}
+
+@test "test verb reports examples in TAP format" {
+    usage="
+Usage: prog ship new <name>...
+
+Examples:
+  \$ prog ship new a b  # => '<name>=[a b]' new=true
+  \$ prog ship          # => error
+"
+    run $DOCOPTS_BIN test "$usage"
+    echo "$output"
+    [[ $status -eq 0 ]]
+    [[ "${lines[0]}" == '1..2' ]]
+    [[ "${lines[1]}" == 'ok 1 - prog ship new a b' ]]
+
+    usage="
+Usage: prog ship new <name>...
+
+Examples:
+  \$ prog ship new a b  # => '<name>=[a b]' new=true
+  \$ prog ship          # => error
+  \$ prog ship new      # => new=true
+"
+    run $DOCOPTS_BIN test "$usage"
+    echo "$output"
+    [[ $status -eq 1 ]]
+    [[ "${lines[3]}" == 'not ok 3 - prog ship new' ]]
+}
+
+@test "fmt outputs canonical usage and --check fails on unformatted usage" {
+    usage="Usage: prog [--speed=<kn>]
+
+Options:
+    --speed <kn>   [default: 10] Speed in knots."
+    run $DOCOPTS_BIN fmt "$usage"
+    echo "$output"
+    [[ $status -eq 0 ]]
+    [[ "${lines[1]}" == '  prog [--speed=<kn>]' ]]
+    expected_regexp='  --speed=<kn>  Speed in knots\. \[default: 10\]'
+    [[ "$output" =~ $expected_regexp ]]
+
+    run $DOCOPTS_BIN fmt --check "$usage"
+    [[ $status -eq 1 ]]
+
+    formatted=$($DOCOPTS_BIN fmt "$usage")
+    run $DOCOPTS_BIN fmt --check "$formatted"
+    [[ $status -eq 0 ]]
+}
+
+@test "diff exits 1 on breaking changes" {
+    run $DOCOPTS_BIN diff 'Usage: prog [--speed=<kn>]' 'Usage: prog [--speed=<kn>] [--color]'
+    echo "$output"
+    [[ $status -eq 0 ]]
+    [[ "${lines[0]}" == 'non-breaking: option --color added' ]]
+
+    run $DOCOPTS_BIN diff 'Usage: prog [--speed=<kn>]' 'Usage: prog [--velocity=<kn>]'
+    echo "$output"
+    [[ $status -eq 1 ]]
+    [[ "${lines[0]}" == 'breaking: option --speed removed' ]]
+}
+
+@test "--connect gives the same output as one-shot docopts" {
+    socket=$BATS_TMPDIR/docopts_$$.sock
+    $DOCOPTS_BIN serve --socket=$socket &
+    server_pid=$!
+    while [[ ! -S $socket ]] ; do sleep 0.1 ; done
+
+    usage='Usage: prog [-v] <file>...'
+    run $DOCOPTS_BIN --connect=$socket -A args -h "$usage" : -v a b
+    kill $server_pid
+    echo "$output"
+    [[ $status -eq 0 ]]
+    [[ "$output" == "$($DOCOPTS_BIN -A args -h "$usage" : -v a b)" ]]
+}
+
+@test "--cache-dir gives the same output and stores the compiled usage" {
+    cache_dir=$BATS_TMPDIR/docopts_cache_$$
+    usage='Usage: prog [-v] <file>...'
+    run $DOCOPTS_BIN --cache-dir=$cache_dir -A args -h "$usage" : -v a b
+    echo "$output"
+    [[ $status -eq 0 ]]
+    [[ "$output" == "$($DOCOPTS_BIN -A args -h "$usage" : -v a b)" ]]
+    [[ $(ls $cache_dir | wc -l) -eq 1 ]]
+
+    # from the cache
+    run $DOCOPTS_BIN --cache-dir=$cache_dir -A args -h "$usage" : -v a b
+    [[ "$output" == "$($DOCOPTS_BIN -A args -h "$usage" : -v a b)" ]]
+    rm -rf $cache_dir
+}
+
+@test "--dispatch calls the function of the given commands" {
+    usage='Usage:
+  prog remote add <name>
+  prog status'
+    cmd_remote_add() { echo "add $name ${docopt_command[*]}" ; }
+    eval "$($DOCOPTS_BIN --dispatch cmd_ -h "$usage" : remote add origin)" > $BATS_TMPDIR/dispatch_$$
+    [[ "$(cat $BATS_TMPDIR/dispatch_$$)" == 'add origin remote add' ]]
+    rm -f $BATS_TMPDIR/dispatch_$$
+
+    run bash -c "eval \"\$($DOCOPTS_BIN --dispatch cmd_ -h '$usage' : status)\""
+    echo "$output"
+    [[ $status -eq 70 ]]
+    [[ "$output" == 'error: function cmd_status not found for command: status' ]]
+}
+
+@test "exec exports parsed arguments and runs the command" {
+    usage='Usage: prog [-v] <file>...'
+    run $DOCOPTS_BIN exec -h "$usage" --env-prefix APP_ : -v a 'b c' -- sh -c 'echo "$APP_v $APP_file_COUNT $APP_file_1"'
+    echo "$output"
+    [[ $status -eq 0 ]]
+    [[ "$output" == 'true 2 b c' ]]
+
+    run $DOCOPTS_BIN exec -h "$usage" : -- true
+    [[ $status -eq 64 ]]
+
+    # the command follows the first --, or the one after --argc arguments
+    run $DOCOPTS_BIN exec -h 'Usage: prog <file>' : x -- printf '%s\n' -- y
+    [[ $status -eq 0 ]]
+    [[ "$output" == $'--\ny' ]]
+
+    run $DOCOPTS_BIN exec -h 'Usage: prog [--] <file>' --argc=2 : -- -x -- sh -c 'echo "$file"'
+    [[ $status -eq 0 ]]
+    [[ "$output" == '-x' ]]
+}
+
+@test "run parses the script usage before bash starts" {
+    script=$BATS_TMPDIR/run_script.sh
+    cat > $script <<'EOS'
+# Usage: prog [-v] <file>...
+#
+# ----
+# prog 1.0
+# ----
+
+echo "$v ${file[*]} ${BASH_ENV-unset}"
+EOS
+    run $DOCOPTS_BIN run bash $script -v a 'b c'
+    echo "$output"
+    [[ $status -eq 0 ]]
+    [[ "$output" == 'true a b c unset' ]]
+
+    run $DOCOPTS_BIN run bash $script --version
+    [[ $status -eq 0 ]]
+    [[ "$output" == 'prog 1.0' ]]
+
+    run $DOCOPTS_BIN run bash $script
+    [[ $status -eq 64 ]]
+    rm -f $script
+}
+
+@test "lib outputs the embedded docopts.sh" {
+    run $DOCOPTS_BIN lib
+    [[ $status -eq 0 ]]
+    [[ "$output" == "$(cat ../docopts.sh)" ]]
+
+    run $DOCOPTS_BIN lib --check ../docopts.sh
+    [[ $status -eq 0 ]]
+    run $DOCOPTS_BIN lib --check $BATS_TEST_FILENAME
+    [[ $status -eq 1 ]]
+}
+
+@test "doctor reports the environment" {
+    run $DOCOPTS_BIN doctor
+    echo "$output"
+    [[ "$output" =~ bash:\ .*\  ]]
+    [[ "$output" =~ awk: ]]
+
+    run $DOCOPTS_BIN doctor --bash=not_a_bash_$$
+    [[ $status -eq 1 ]]
+    [[ "$output" =~ "warning:     bash not found" ]]
+}
+
+@test "version --json lists the capabilities" {
+    run $DOCOPTS_BIN version --json
+    [[ $status -eq 0 ]]
+    [[ "$output" =~ \"verbs\": ]]
+    [[ "$output" =~ \"exec\" ]]
+    [[ "$output" =~ \"output_modes\": ]]
+}
+
+@test "[type: ...] annotation converts and validates values" {
+    usage='Usage: prog [--timeout=<t>] <n>
+
+Options:
+  --timeout=<t>  Timeout [type: duration] [default: 1m]
+  <n>            Count [type: int]'
+    run $DOCOPTS_BIN -h "$usage" : --timeout 10m 3
+    echo "$output"
+    [[ $status -eq 0 ]]
+    [[ "${lines[0]}" == 'timeout=600' ]]
+    [[ "${lines[1]}" == 'n=3' ]]
+
+    run $DOCOPTS_BIN -h "$usage" : three
+    [[ $status -eq 1 ]]
+    [[ "${lines[0]}" =~ "error: <n>: invalid int value" ]]
+}
+
+@test "[env: NAME] annotation fills a missing option before its default" {
+    usage='Usage: prog [--token=<t>]
+
+Options:
+  --token=<t>  API token [default: anon] [env: TEST_DOCOPTS_TOKEN]'
+    run $DOCOPTS_BIN -h "$usage" :
+    [[ "$output" == "token='anon'" ]]
+
+    TEST_DOCOPTS_TOKEN=secret run $DOCOPTS_BIN -h "$usage" :
+    [[ "$output" == "token='secret'" ]]
+
+    TEST_DOCOPTS_TOKEN=secret run $DOCOPTS_BIN -h "$usage" : --token=given
+    [[ "$output" == "token='given'" ]]
+}
+
+@test "[config: path] annotation fills options from a config file" {
+    config=$(mktemp --suffix=.ini)
+    printf 'speed = 5\ntag = a\ntag = b\n' > "$config"
+    usage="Usage: prog [--conf=<f>] [--speed=<s>] [--tag=<t>...]
+
+Options:
+  --conf=<f>   Config file [config: $config]
+  --speed=<s>  Speed [default: 1]
+  --tag=<t>    Tags"
+    run $DOCOPTS_BIN -h "$usage" : --speed=7
+    echo "$output"
+    [[ $status -eq 0 ]]
+    [[ "${lines[1]}" == "speed='7'" ]]
+    [[ "${lines[2]}" == "tag=('a' 'b')" ]]
+
+    printf 'unknown = 1\n' > "$config"
+    run $DOCOPTS_BIN -h "$usage" :
+    [[ $status -eq 1 ]]
+    [[ "$output" =~ "unknown" ]]
+    rm -f "$config"
+}
+
+@test "[path: ...] annotation checks paths" {
+    usage='Usage: prog FILENAME
+
+Options:
+  FILENAME  The file to parse [path: file,exists,stdin-ok]'
+    run $DOCOPTS_BIN -h "$usage" : -
+    [[ $status -eq 0 ]]
+    [[ "$output" == "FILENAME='/dev/stdin'" ]]
+
+    run $DOCOPTS_BIN -h "$usage" : /nonexistent/file
+    [[ $status -eq 1 ]]
+    [[ "${lines[0]}" =~ "error: FILENAME: no such file or directory" ]]
+}
+
+@test "[pattern: regexp] annotation validates values" {
+    usage='Usage: prog <host>...
+
+Options:
+  <host>  Host names [pattern: ^[a-z0-9-]+$] [pattern-message: not a host name]'
+    run $DOCOPTS_BIN -h "$usage" : web-1 db
+    [[ $status -eq 0 ]]
+    [[ "$output" == "host=('web-1' 'db')" ]]
+
+    run $DOCOPTS_BIN -h "$usage" : web Web_2
+    [[ $status -eq 1 ]]
+    [[ "${lines[0]}" =~ "error: <host>: not a host name" ]]
+}
+
+@test "[min: N] [max: N] [unique] annotations constrain repeatable elements" {
+    usage='Usage: prog <host>...
+
+Options:
+  <host>  Hosts [min: 2] [max: 3] [unique]'
+    run $DOCOPTS_BIN -h "$usage" : h1 h2
+    [[ $status -eq 0 ]]
+
+    run $DOCOPTS_BIN -h "$usage" : h1 h2 h3 h4
+    [[ $status -eq 1 ]]
+    [[ "${lines[0]}" =~ "error: <host> given 4 times, at most 3 allowed" ]]
+
+    run $DOCOPTS_BIN -h "$usage" : h1
+    [[ "${lines[0]}" =~ "error: <host> given 1 time, at least 2 required" ]]
+
+    run $DOCOPTS_BIN -h "$usage" : h1 h1
+    [[ "${lines[0]}" =~ "given more than once" ]]
+}
+
+@test "Constraints: section checks requires and conflicts" {
+    usage='Usage: prog [--cert=<c>] [--key=<k>] [--json] [--color=<when>]
+
+Options:
+  --color=<when>  Color [default: auto]
+
+Constraints:
+  --cert requires --key
+  --json conflicts --color'
+    run $DOCOPTS_BIN -h "$usage" : --cert=c --key=k --json
+    [[ $status -eq 0 ]]
+
+    run $DOCOPTS_BIN -h "$usage" : --cert=c
+    [[ $status -eq 1 ]]
+    [[ "${lines[0]}" =~ "error: --cert requires --key" ]]
+
+    run $DOCOPTS_BIN -h "$usage" : --json --color=never
+    [[ "${lines[0]}" =~ "error: --json conflicts with --color" ]]
+
+    # the default given on argv is given
+    run $DOCOPTS_BIN -h "$usage" : --json --color=auto
+    [[ "${lines[0]}" =~ "error: --json conflicts with --color" ]]
+}
+
+@test "[hidden] [deprecated: ] [alias-of: ] annotations rename an option" {
+    usage='Usage: prog [options]
+
+Options:
+  --new-name=<n>  The new name
+  --old-name=<n>  [hidden] [deprecated: use --new-name] [alias-of: --new-name]'
+    run $DOCOPTS_BIN -h "$usage" : --old-name=x
+    echo "$output"
+    [[ $status -eq 0 ]]
+    [[ "${lines[0]}" == "echo 'warning: --old-name is deprecated: use --new-name' >&2" ]]
+    [[ "${lines[1]}" == "new_name='x'" ]]
+    [[ ${#lines[@]} -eq 2 ]]
+
+    run $DOCOPTS_BIN -h "$usage" : --help
+    [[ ! "$output" =~ "old-name" ]]
+}
+
+@test "--[no-]name negatable flags output a single variable" {
+    usage='Usage: prog [--[no-]color]
+
+Options:
+  --[no-]color  Colorize the output [default: true]'
+    run $DOCOPTS_BIN -h "$usage" :
+    [[ "$output" == "color=true" ]]
+
+    run $DOCOPTS_BIN -h "$usage" : --no-color
+    [[ "$output" == "color=false" ]]
+
+    run $DOCOPTS_BIN -h "$usage" : --no-color --color
+    [[ "$output" == "color=true" ]]
+
+    # a usage error displays the usage as written
+    run $DOCOPTS_BIN -h "$usage" : extra
+    [[ $status -eq 1 ]]
+    [[ "${lines[1]}" == "Usage: prog [--[no-]color]' >&2" ]]
+}
+
+@test "--name[=<arg>] options with [default-if-present: value]" {
+    usage='Usage: prog [--color[=<when>]] [<file>...]
+
+Options:
+  --color[=<when>]  Colorize [default-if-present: auto] [default: never]'
+    run $DOCOPTS_BIN -h "$usage" :
+    [[ "${lines[0]}" == "color='never'" ]]
+
+    run $DOCOPTS_BIN -h "$usage" : --color foo
+    [[ "${lines[0]}" == "color='auto'" ]]
+    [[ "${lines[1]}" == "file=('foo')" ]]
+
+    run $DOCOPTS_BIN -h "$usage" : --color=always
+    [[ "${lines[0]}" == "color='always'" ]]
+
+    # a usage error displays the usage as written
+    run $DOCOPTS_BIN -h "$usage" : --bad
+    [[ $status -eq 1 ]]
+    [[ "${lines[1]}" == "Usage: prog [--color[=<when>]] [<file>...]' >&2" ]]
+}
+
+@test "[map] annotation outputs an associative array" {
+    usage='Usage: prog [--set=<kv>...]
+
+Options:
+  --set=<kv>  Settings [map]'
+    run $DOCOPTS_BIN -h "$usage" : --set a=1 --set b=2
+    [[ $status -eq 0 ]]
+    [[ "$output" == "declare -gA set=(['a']='1' ['b']='2')" ]]
+
+    run $DOCOPTS_BIN -A args -h "$usage" : --set a=1
+    [[ "${lines[1]}" == "args['--set:a']='1'" ]]
+
+    eval "$($DOCOPTS_BIN -h "$usage" : --set 'a b=c')"
+    [[ "${set[a b]}" == 'c' ]]
+
+    # global when eval is run in a function, as in main()
+    unset set
+    parse() { eval "$($DOCOPTS_BIN -h "$usage" : --set a=1)"; }
+    parse
+    [[ "${set[a]}" == '1' ]]
+}
+
+@test "[split: SEP] annotation splits values into an array" {
+    usage='Usage: prog [--tags=<t>...]
+
+Options:
+  --tags=<t>  Tags [split: ,]'
+    run $DOCOPTS_BIN -h "$usage" : --tags=a,b --tags c
+    [[ $status -eq 0 ]]
+    [[ "$output" == "tags=('a' 'b' 'c')" ]]
+
+    run $DOCOPTS_BIN -h "$usage" : --tags 'a\,b,c'
+    [[ "$output" == "tags=('a,b' 'c')" ]]
+}
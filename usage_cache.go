@@ -0,0 +1,142 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// usage_cache.go keeps usage messages compiled by docopt_engine, in memory
+// for docopts serve and on disk for --cache.
+//
+// On disk, a file per usage is named by the hash of the usage message, of the
+// docopts version and of the serialized format: files of other versions are
+// never read. Files are written under a temporary name then renamed, so
+// concurrent writers are safe.
+//
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/docopt/docopts/docopt_engine"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// how many compiled usages are kept in memory
+const usage_cache_size = 256
+
+func init() {
+	Register_flag("--cache")
+	Register_flag("--cache-dir")
+}
+
+// Usage_cache keeps compiled usages, safe for concurrent use.
+type Usage_cache struct {
+	// directory of the disk cache, empty for memory only
+	Dir    string
+	mutex  sync.Mutex
+	usages map[string]*docopt_engine.Usage
+}
+
+func New_usage_cache() *Usage_cache {
+	return &Usage_cache{usages: make(map[string]*docopt_engine.Usage)}
+}
+
+func New_disk_cache(dir string) *Usage_cache {
+	c := New_usage_cache()
+	c.Dir = dir
+	return c
+}
+
+// Default_cache_dir returns $XDG_CACHE_HOME/docopts, $XDG_CACHE_HOME defaults
+// to ~/.cache. It returns "" when there is no absolute cache home, the disk
+// cache is then skipped rather than written relative to the current directory.
+func Default_cache_dir() string {
+	cache_home := os.Getenv("XDG_CACHE_HOME")
+	if !filepath.IsAbs(cache_home) {
+		home, err := os.UserHomeDir()
+		if err != nil || !filepath.IsAbs(home) {
+			return ""
+		}
+		cache_home = filepath.Join(home, ".cache")
+	}
+	return filepath.Join(cache_home, "docopts")
+}
+
+// Cache_key returns the file name of doc in the disk cache.
+func Cache_key(doc string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%d\x00%s", Docopts_Version, docopt_engine.Format, doc)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Get returns the compiled usage of doc, it is compiled on first use. Usages
+// with errors are not kept. Disk cache errors are ignored: doc is compiled.
+func (c *Usage_cache) Get(doc string) (*docopt_engine.Usage, error) {
+	c.mutex.Lock()
+	u, found := c.usages[doc]
+	c.mutex.Unlock()
+	if found {
+		return u, nil
+	}
+
+	if c.Dir != "" {
+		u = c.load(doc)
+	}
+	if u == nil {
+		var err error
+		u, err = docopt_engine.Compile(doc)
+		if err != nil {
+			return nil, err
+		}
+		if c.Dir != "" {
+			c.store(u)
+		}
+	}
+
+	c.mutex.Lock()
+	if len(c.usages) >= usage_cache_size {
+		c.usages = make(map[string]*docopt_engine.Usage)
+	}
+	c.usages[doc] = u
+	c.mutex.Unlock()
+	return u, nil
+}
+
+// load returns nil if doc is not found or if the file cannot be decoded, it
+// will be replaced.
+func (c *Usage_cache) load(doc string) *docopt_engine.Usage {
+	data, err := ioutil.ReadFile(filepath.Join(c.Dir, Cache_key(doc)))
+	if err != nil {
+		return nil
+	}
+	u := &docopt_engine.Usage{}
+	if u.UnmarshalBinary(data) != nil || u.Doc() != doc {
+		return nil
+	}
+	return u
+}
+
+func (c *Usage_cache) store(u *docopt_engine.Usage) error {
+	data, err := u.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(c.Dir, 0700); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(c.Dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if close_err := f.Close(); err == nil {
+		err = close_err
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filepath.Join(c.Dir, Cache_key(u.Doc())))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
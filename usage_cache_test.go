@@ -0,0 +1,169 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// unit test for usage_cache.go
+//
+package main
+
+import (
+	"github.com/docopt/docopt-go"
+	"github.com/docopt/docopts/docopt_engine"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func temp_cache_dir(t testing.TB) string {
+	dir, err := ioutil.TempDir("", "docopts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "cache")
+}
+
+func TestUsage_cache_Get(t *testing.T) {
+	dir := temp_cache_dir(t)
+	defer os.RemoveAll(filepath.Dir(dir))
+	path := filepath.Join(dir, Cache_key(naval_fate))
+	argv := []string{"ship", "new", "foo"}
+	expected, _ := docopt.ParseArgs(naval_fate, argv, "")
+
+	check := func(c *Usage_cache, message string) {
+		u, err := c.Get(naval_fate)
+		if err != nil {
+			t.Fatalf("Get %s error: %v", message, err)
+		}
+		args, err := (&docopt_engine.Parser{}).ParseArgs(u, argv, "")
+		if err != nil || !reflect.DeepEqual(docopt.Opts(args), expected) {
+			t.Errorf("Get %s: got: %v, want: %v", message, args, expected)
+		}
+	}
+
+	check(New_disk_cache(dir), "compiled")
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("Get: cache file not written: %v", err)
+	}
+	check(New_disk_cache(dir), "from disk")
+
+	// invalid files are replaced
+	ioutil.WriteFile(path, []byte("garbage"), 0600)
+	check(New_disk_cache(dir), "invalid file")
+	if data, _ := ioutil.ReadFile(path); string(data) == "garbage" {
+		t.Errorf("Get: invalid cache file not replaced")
+	}
+
+	// another usage with the same key is not taken
+	data, _ := ioutil.ReadFile(path)
+	ioutil.WriteFile(filepath.Join(dir, Cache_key("Usage: prog")), data, 0600)
+	u, err := New_disk_cache(dir).Get("Usage: prog")
+	if err != nil || u.Doc() != "Usage: prog" {
+		t.Errorf("Get: wrong usage taken from disk: %v", err)
+	}
+
+	// concurrent writers
+	os.RemoveAll(dir)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			check(New_disk_cache(dir), "concurrent")
+		}()
+	}
+	wg.Wait()
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 || files[0].Name() != Cache_key(naval_fate) {
+		t.Errorf("Get concurrent: expecting one file in cache, got: %d", len(files))
+	}
+
+	// errors are not kept, and the disk cache is optional
+	c := New_disk_cache(filepath.Join(path, "not_a_dir"))
+	if _, err := c.Get("Usage: prog ("); err == nil {
+		t.Errorf("Get expecting error on invalid usage")
+	}
+	check(c, "unwritable directory")
+}
+
+func TestDefault_cache_dir(t *testing.T) {
+	for _, name := range []string{"XDG_CACHE_HOME", "HOME"} {
+		if value, found := os.LookupEnv(name); found {
+			defer os.Setenv(name, value)
+		} else {
+			defer os.Unsetenv(name)
+		}
+	}
+
+	tables := []struct {
+		xdg_cache_home string
+		home           string
+		expected       string
+	}{
+		{"/tmp/cache", "/home/user", "/tmp/cache/docopts"},
+		{"", "/home/user", "/home/user/.cache/docopts"},
+		{"relative", "/home/user", "/home/user/.cache/docopts"},
+		{"", "", ""},
+		{"", "relative", ""},
+	}
+	for _, table := range tables {
+		os.Setenv("XDG_CACHE_HOME", table.xdg_cache_home)
+		os.Setenv("HOME", table.home)
+		if dir := Default_cache_dir(); dir != table.expected {
+			t.Errorf("Default_cache_dir: XDG_CACHE_HOME='%s' HOME='%s': got '%s', expected '%s'",
+				table.xdg_cache_home, table.home, dir, table.expected)
+		}
+	}
+}
+
+func TestCache_key(t *testing.T) {
+	key := Cache_key(naval_fate)
+	if key == Cache_key("Usage: prog") {
+		t.Errorf("Cache_key: same key for different usages")
+	}
+	bak := Docopts_Version
+	Docopts_Version = "another version"
+	defer func() { Docopts_Version = bak }()
+	if key == Cache_key(naval_fate) {
+		t.Errorf("Cache_key: same key for different docopts versions")
+	}
+}
+
+// Benchmarks of a new docopts process: without cache the usage is compiled
+// each time, the disk cache decodes the compiled usage. docopts's own usage is
+// used as a large usage message. Run with: go test -bench Parse
+func BenchmarkParse_compile(b *testing.B) {
+	parser := &docopt_engine.Parser{}
+	argv := []string{"-h", naval_fate, ":", "ship", "new", "foo"}
+	for i := 0; i < b.N; i++ {
+		parser.ParseDoc(Usage, argv, "")
+	}
+}
+
+func BenchmarkParse_disk_cache(b *testing.B) {
+	dir := temp_cache_dir(b)
+	defer os.RemoveAll(filepath.Dir(dir))
+	New_disk_cache(dir).Get(Usage)
+
+	parser := &docopt_engine.Parser{}
+	argv := []string{"-h", naval_fate, ":", "ship", "new", "foo"}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		u, err := New_disk_cache(dir).Get(Usage)
+		if err != nil {
+			b.Fatal(err)
+		}
+		parser.ParseArgs(u, argv, "")
+	}
+}
+
+// docopts serve: the usage is compiled once
+func BenchmarkParse_memory_cache(b *testing.B) {
+	c := New_usage_cache()
+	parser := &docopt_engine.Parser{}
+	argv := []string{"-h", naval_fate, ":", "ship", "new", "foo"}
+	for i := 0; i < b.N; i++ {
+		u, _ := c.Get(Usage)
+		parser.ParseArgs(u, argv, "")
+	}
+}
@@ -0,0 +1,324 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// usage_diff.go implements the verb: docopts diff
+//
+// Two versions of a usage are compared, each change is classified as breaking
+// (an existing caller or script can fail or behave differently) or not.
+//
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var Usage_diff string = `Report the changes between two versions of a usage message.
+
+Usage:
+  docopts diff [-G <prefix>] <old_msg> <new_msg>
+  docopts diff --help
+
+Options:
+  -G <prefix>  Variable names are compared as generated with this prefix, see
+               docopts --help.
+  <old_msg>    The usage message in docopt format before the change. If - is
+               given, read the usage message from standard input.
+  <new_msg>    The usage message in docopt format after the change.
+
+The exit code is 1 if a breaking change is found, 0 otherwise.
+`
+
+func init() {
+	verbs["diff"] = Verb_diff
+}
+
+type Usage_change struct {
+	Breaking bool
+	Message  string
+}
+
+func (c Usage_change) String() string {
+	if c.Breaking {
+		return "breaking: " + c.Message
+	}
+	return "non-breaking: " + c.Message
+}
+
+func Verb_diff(argv []string) int {
+	arguments := Parse_verb_args(Usage_diff, argv)
+
+	d := &Docopts{
+		Global_prefix: "",
+		Mangle_key:    true,
+	}
+	global_prefix, err := arguments.String("-G")
+	if err == nil {
+		d.Global_prefix = global_prefix
+	}
+
+	changes, err := d.Diff_usage(Read_msg(arguments["<old_msg>"].(string)),
+		Read_msg(arguments["<new_msg>"].(string)))
+	if err != nil {
+		docopts_error("diff: %v", err)
+	}
+
+	status := 0
+	for _, c := range changes {
+		fmt.Fprintln(out, c)
+		if c.Breaking {
+			status = 1
+		}
+	}
+	return status
+}
+
+// Diff_usage compares two usages: options, commands, arguments requirement,
+// defaults, value types and the variable names given by Name_mangle().
+func (d *Docopts) Diff_usage(old_doc, new_doc string) ([]Usage_change, error) {
+	old_model, err := Parse_annotated_usage(old_doc)
+	if err != nil {
+		return nil, fmt.Errorf("old usage: %v", err)
+	}
+	new_model, err := Parse_annotated_usage(new_doc)
+	if err != nil {
+		return nil, fmt.Errorf("new usage: %v", err)
+	}
+
+	changes := []Usage_change{}
+	add := func(breaking bool, msg string, a ...interface{}) {
+		changes = append(changes, Usage_change{breaking, fmt.Sprintf(msg, a...)})
+	}
+
+	old_leaves := string_set(old_model.Leaves())
+	new_leaves := string_set(new_model.Leaves())
+
+	for _, key := range old_model.Leaves() {
+		kind := kind_name(old_model.Leaf_kind(key))
+		if !new_leaves[key] {
+			add(true, "%s %s removed", kind, key)
+			continue
+		}
+		old_type := old_model.describe_leaf(key)
+		if new_type := new_model.describe_leaf(key); old_type != new_type {
+			add(true, "value of %s changed from %s to %s", key, old_type, new_type)
+		}
+
+		old_option := old_model.Find_option(key)
+		new_option := new_model.Find_option(key)
+		if old_option == nil || new_option == nil {
+			continue
+		}
+		if old_option.Short != "" && old_option.Short != new_option.Short {
+			add(true, "option %s removed from %s", old_option.Short, key)
+		}
+		switch {
+		case old_option.Has_default && !new_option.Has_default:
+			add(true, "default of %s removed, was: %s", key, old_option.Default)
+		case !old_option.Has_default && new_option.Has_default:
+			add(false, "default of %s added: %s", key, new_option.Default)
+		case old_option.Default != new_option.Default:
+			add(true, "default of %s changed: %s => %s", key, old_option.Default, new_option.Default)
+		}
+	}
+	for _, key := range new_model.Leaves() {
+		if !old_leaves[key] {
+			add(false, "%s %s added", kind_name(new_model.Leaf_kind(key)), key)
+		}
+		old_option := old_model.Find_option(key)
+		new_option := new_model.Find_option(key)
+		if old_option != nil && new_option != nil && new_option.Short != "" && old_option.Short != new_option.Short {
+			add(false, "option %s added to %s", new_option.Short, key)
+		}
+	}
+
+	// requirements of each old usage line compared to the new lines selecting
+	// the same commands, lines using removed elements are already reported
+	new_lines := new_model.Required_by_line()
+	reported := make(map[string]bool)
+	for _, old_line := range old_model.Required_by_line() {
+		if !is_subset(old_line.Required, new_leaves) {
+			continue
+		}
+		var added map[string]bool
+		for _, new_line := range new_lines {
+			if new_line.Path != old_line.Path {
+				continue
+			}
+			line_added := make(map[string]bool)
+			for key := range new_line.Required {
+				if !old_line.Required[key] {
+					line_added[key] = true
+				}
+			}
+			if added == nil || len(line_added) < len(added) {
+				added = line_added
+			}
+		}
+		if added == nil {
+			if old_line.Path != "" && !reported[old_line.Path] {
+				add(true, "usage '%s %s' removed", old_model.Prog, old_line.Path)
+				reported[old_line.Path] = true
+			}
+			continue
+		}
+		for _, key := range sorted_set(added) {
+			if !reported[old_line.Path+"\n"+key] {
+				add(true, "%s %s became required in: %s", kind_name(new_model.Leaf_kind(key)),
+					key, strings.TrimSpace(new_model.Prog+" "+old_line.Path))
+				reported[old_line.Path+"\n"+key] = true
+			}
+		}
+	}
+
+	// variables as generated in global mode
+	old_vars, _ := d.mangled_names(old_model)
+	new_vars, errors := d.mangled_names(new_model)
+	for _, e := range errors {
+		add(true, "%v", e)
+	}
+	for _, name := range sorted_names(old_vars) {
+		if _, found := new_vars[name]; !found {
+			add(true, "variable $%s removed (was %s)", name, old_vars[name])
+		} else if old_vars[name] != new_vars[name] {
+			add(false, "variable $%s now set by %s (was %s)", name, new_vars[name], old_vars[name])
+		}
+	}
+	for _, name := range sorted_names(new_vars) {
+		if _, found := old_vars[name]; !found {
+			add(false, "variable $%s added (set by %s)", name, new_vars[name])
+		}
+	}
+
+	return changes, nil
+}
+
+// mangled_names returns mangled variable name => key for all leaves.
+func (d *Docopts) mangled_names(m *Usage_model) (map[string]string, []error) {
+	vars := make(map[string]string)
+	errors := []error{}
+	for _, key := range m.Leaves() {
+		if key == "--" && d.Global_prefix == "" {
+			continue
+		}
+		name, err := d.Name_mangle(key)
+		if err != nil {
+			errors = append(errors, err)
+			continue
+		}
+		if prev_key, seen := vars[name]; seen {
+			errors = append(errors, fmt.Errorf("%s: two or more elements have identically mangled names", prev_key))
+			continue
+		}
+		vars[name] = key
+	}
+	return vars, errors
+}
+
+// The leaves required by a usage line and the commands it selects.
+type Line_requirement struct {
+	// space separated required commands, in usage order
+	Path     string
+	Required map[string]bool
+}
+
+// Required_by_line returns the requirements of each usage line.
+func (m *Usage_model) Required_by_line() []Line_requirement {
+	lines := []*Pattern{m.Pattern}
+	if m.Pattern.Kind == Pattern_either {
+		lines = m.Pattern.Children
+	}
+
+	result := []Line_requirement{}
+	for _, line := range lines {
+		required := required_leaves(line)
+		commands := []string{}
+		var walk func(p *Pattern)
+		walk = func(p *Pattern) {
+			if p.Kind == Pattern_command && required[p.Name] {
+				commands = append(commands, p.Name)
+			}
+			for _, c := range p.Children {
+				walk(c)
+			}
+		}
+		walk(line)
+		result = append(result, Line_requirement{strings.Join(commands, " "), required})
+	}
+	return result
+}
+
+// required_leaves returns the leaves which must be given to match p.
+func required_leaves(p *Pattern) map[string]bool {
+	required := make(map[string]bool)
+	switch p.Kind {
+	case Pattern_option, Pattern_argument, Pattern_command:
+		required[p.Name] = true
+	case Pattern_required, Pattern_one_or_more:
+		for _, c := range p.Children {
+			for key := range required_leaves(c) {
+				required[key] = true
+			}
+		}
+	case Pattern_either:
+		// only leaves required by all alternatives
+		for i, c := range p.Children {
+			child := required_leaves(c)
+			if i == 0 {
+				required = child
+				continue
+			}
+			for key := range required {
+				if !child[key] {
+					delete(required, key)
+				}
+			}
+		}
+	}
+	return required
+}
+
+func kind_name(kind Pattern_kind) string {
+	switch kind {
+	case Pattern_option:
+		return "option"
+	case Pattern_argument:
+		return "argument"
+	}
+	return "command"
+}
+
+func is_subset(set map[string]bool, of map[string]bool) bool {
+	for key := range set {
+		if !of[key] {
+			return false
+		}
+	}
+	return true
+}
+
+func string_set(list []string) map[string]bool {
+	set := make(map[string]bool)
+	for _, s := range list {
+		set[s] = true
+	}
+	return set
+}
+
+func sorted_set(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sorted_names(vars map[string]string) []string {
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
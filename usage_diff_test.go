@@ -0,0 +1,115 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// unit test for usage_diff.go
+//
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiff_usage(t *testing.T) {
+	tables := []struct {
+		old_doc string
+		new_doc string
+		expect  []string
+	}{
+		{naval_fate, naval_fate, []string{}},
+		{
+			"Usage: prog a b\n       prog b",
+			"Usage: prog a b",
+			[]string{"breaking: usage 'prog b' removed"},
+		},
+		{
+			naval_fate,
+			strings.Replace(naval_fate, "[default: 10]", "[default: 20]", 1),
+			[]string{"breaking: default of --speed changed: 10 => 20"},
+		},
+		{
+			naval_fate,
+			strings.Replace(naval_fate, "  naval_fate.py --version\n", "", 1),
+			[]string{
+				"breaking: option --version removed",
+				"breaking: variable $version removed (was --version)",
+			},
+		},
+		{
+			"Usage: prog [-v] <file>\n\nOptions:\n  -v, --verbose  Verbose.",
+			"Usage: prog [--verbose] [-q] <file> <dest>\n\nOptions:\n  --verbose  Verbose.\n  -q  Quiet.",
+			[]string{
+				"breaking: option -v removed from --verbose",
+				"non-breaking: option -q added",
+				"non-breaking: argument <dest> added",
+				"breaking: argument <dest> became required in: prog",
+				"non-breaking: variable $dest added (set by <dest>)",
+				"non-breaking: variable $q added (set by -q)",
+			},
+		},
+		{
+			"Usage: prog remote add <url>\n       prog remote rm <name>\n       prog [--tag=<t>]",
+			"Usage: prog remote add <url> <name>\n       prog [--tag=<t>]...",
+			[]string{
+				"breaking: value of --tag changed from string to array",
+				"breaking: command rm removed",
+				"breaking: argument <name> became required in: prog remote add",
+				"breaking: variable $rm removed (was rm)",
+			},
+		},
+		{
+			"Usage: prog <file-name>",
+			"Usage: prog FILE_NAME",
+			[]string{
+				"breaking: argument <file-name> removed",
+				"non-breaking: argument FILE_NAME added",
+				"breaking: variable $file_name removed (was <file-name>)",
+				"non-breaking: variable $FILE_NAME added (set by FILE_NAME)",
+			},
+		},
+		{extended_syntax, extended_syntax, []string{}},
+		{
+			"Usage: prog [options]\n\nOptions:\n  --color  Color.",
+			"Usage: prog [options]\n\nOptions:\n  --[no-]color  Color.",
+			[]string{},
+		},
+	}
+
+	d := &Docopts{Mangle_key: true}
+	for _, table := range tables {
+		changes, err := d.Diff_usage(table.old_doc, table.new_doc)
+		if err != nil {
+			t.Errorf("Diff_usage error: %v", err)
+		}
+		res := []string{}
+		for _, c := range changes {
+			res = append(res, c.String())
+		}
+		if !reflect.DeepEqual(res, table.expect) {
+			t.Errorf("Diff_usage for '%s' => '%s'\ngot: %q\nwant: %q", table.old_doc, table.new_doc, res, table.expect)
+		}
+	}
+
+	if _, err := d.Diff_usage("Usage: prog [", "Usage: prog"); err == nil {
+		t.Errorf("Diff_usage expecting an error on invalid usage")
+	}
+}
+
+func TestRequired_by_line(t *testing.T) {
+	m, err := Parse_usage(naval_fate)
+	if err != nil {
+		t.Fatalf("Parse_usage error: %v", err)
+	}
+	res := m.Required_by_line()
+	expect := []Line_requirement{
+		{"ship new", map[string]bool{"ship": true, "new": true, "<name>": true}},
+		{"ship move", map[string]bool{"ship": true, "move": true, "<name>": true, "<x>": true, "<y>": true}},
+		{"ship shoot", map[string]bool{"ship": true, "shoot": true, "<x>": true, "<y>": true}},
+		{"mine", map[string]bool{"mine": true, "<x>": true, "<y>": true}},
+		{"", map[string]bool{"--help": true}},
+		{"", map[string]bool{"--version": true}},
+	}
+	if !reflect.DeepEqual(res, expect) {
+		t.Errorf("Required_by_line\ngot: %v\nwant: %v", res, expect)
+	}
+}
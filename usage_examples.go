@@ -0,0 +1,260 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// usage_examples.go implements the verb: docopts test
+//
+// Example invocations written in an "Examples:" section of the usage are
+// parsed as docopts parses argv, annotations applied, and compared to their
+// expected result:
+//
+//	Examples:
+//	  $ prog ship new foo   # => <name>=[foo] new=true
+//	  $ prog ship           # => error
+//
+// Values are written as displayed by --debug. The report is in TAP format.
+//
+package main
+
+import (
+	"fmt"
+	"github.com/docopt/docopts/docopt_engine"
+	"sort"
+	"strings"
+)
+
+var Usage_test string = `Check the examples of a usage message against the parser, report in TAP format.
+
+Usage:
+  docopts test [-O] [-H] <msg>
+  docopts test --help
+
+Options:
+  -O, --options-first  Disallow interspersing options and positional
+                       arguments, see docopts --help.
+  -H, --no-help        Don't handle --help and --version specially.
+  <msg>                The usage message in docopt format, with an Examples:
+                       section. If - is given, read the usage message from
+                       standard input.
+
+Examples are lines of the Examples: section starting with '$', the first word
+is the program name, followed by its arguments (shell quoting is supported).
+The expected result follows '# =>': the word error (usage error expected),
+the word help (help or version is displayed) or a list of key=value, where
+value is displayed as in docopts --debug output, quote it if it contains
+spaces: '<file>=[a b]'. Keys not listed are not checked. Without '# =>' the
+example must parse without error. The annotations and the syntax extensions of
+docopts are applied, as for docopts -h <msg>.
+`
+
+func init() {
+	verbs["test"] = Verb_test
+}
+
+type Usage_example struct {
+	// the example line, without the leading '$'
+	Line         string
+	Argv         []string
+	Expect_keys  []string
+	Expect       map[string]string
+	Expect_error bool
+	Expect_help  bool
+}
+
+func Verb_test(argv []string) int {
+	arguments := Parse_verb_args(Usage_test, argv)
+	parser := &docopt_engine.Parser{
+		HelpHandler:   docopt_engine.NoHelpHandler,
+		OptionsFirst:  arguments["--options-first"].(bool),
+		SkipHelpFlags: arguments["--no-help"].(bool),
+	}
+
+	doc := Read_msg(arguments["<msg>"].(string))
+	examples, err := Parse_examples(doc)
+	if err != nil {
+		docopts_error("test: %v", err)
+	}
+	if Run_examples(parser, doc, examples) {
+		return 0
+	}
+	return 1
+}
+
+// Parse_examples reads all examples found in the "examples:" sections.
+func Parse_examples(doc string) ([]*Usage_example, error) {
+	examples := []*Usage_example{}
+	for _, section := range Parse_section("examples:", doc) {
+		for _, line := range strings.Split(section, "\n") {
+			line = strings.TrimSpace(line)
+			if !strings.HasPrefix(line, "$") {
+				continue
+			}
+			e, err := Parse_example(strings.TrimSpace(line[1:]))
+			if err != nil {
+				return nil, fmt.Errorf("example '%s': %v", line, err)
+			}
+			examples = append(examples, e)
+		}
+	}
+	return examples, nil
+}
+
+// Parse_example parses one example line: command line and expected result.
+func Parse_example(line string) (*Usage_example, error) {
+	e := &Usage_example{Expect: make(map[string]string)}
+	command, sep, expect := string_partition(line, "# =>")
+	e.Line = strings.TrimSpace(command)
+
+	words, err := Shell_split(e.Line)
+	if err != nil {
+		return nil, err
+	}
+	if len(words) == 0 {
+		return nil, fmt.Errorf("program name is missing")
+	}
+	e.Argv = words[1:]
+
+	if sep == "" {
+		return e, nil
+	}
+	results, err := Shell_split(expect)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range results {
+		switch {
+		case r == "error" && len(results) == 1:
+			e.Expect_error = true
+		case r == "help" && len(results) == 1:
+			e.Expect_help = true
+		default:
+			key, eq, value := string_partition(r, "=")
+			if eq == "" || key == "" {
+				return nil, fmt.Errorf("expected key=value, got: '%s'", r)
+			}
+			e.Expect_keys = append(e.Expect_keys, key)
+			e.Expect[key] = value
+		}
+	}
+	return e, nil
+}
+
+// Check parses the example as docopts does, annotations applied, and returns
+// the list of mismatches. doc is compiled by cache.
+func (e *Usage_example) Check(parser *docopt_engine.Parser, doc string, cache *Usage_cache) []string {
+	// Apply() keeps the state of a parse: a new Annotated_usage each time
+	a, err := Parse_annotations_cached(doc, cache)
+	if err != nil {
+		return []string{fmt.Sprintf("usage error: %v", err)}
+	}
+	args, err := a.Parse_argv(parser, e.Argv, "")
+	if err != nil {
+		if _, ok := err.(*docopt_engine.LanguageError); ok {
+			return []string{fmt.Sprintf("usage error: %v", err)}
+		}
+		if e.Expect_error {
+			return nil
+		}
+		return []string{fmt.Sprintf("got: error, want: %s", e.want())}
+	}
+	if args == nil {
+		// --help or --version
+		if e.Expect_help {
+			return nil
+		}
+		return []string{fmt.Sprintf("got: help, want: %s", e.want())}
+	}
+	if e.Expect_error || e.Expect_help {
+		return []string{fmt.Sprintf("got: parsed arguments, want: %s", e.want())}
+	}
+
+	failures := []string{}
+	for _, key := range e.Expect_keys {
+		value, found := args[key]
+		if !found {
+			failures = append(failures, fmt.Sprintf("%s: not found in parsed arguments", key))
+			continue
+		}
+		if got := fmt.Sprintf("%v", value); got != e.Expect[key] {
+			failures = append(failures, fmt.Sprintf("%s: got: %s, want: %s", key, got, e.Expect[key]))
+		}
+	}
+	return failures
+}
+
+func (e *Usage_example) want() string {
+	if e.Expect_error {
+		return "error"
+	}
+	if e.Expect_help {
+		return "help"
+	}
+	return "parsed arguments"
+}
+
+// Run_examples outputs the TAP report, returns true if all examples pass.
+func Run_examples(parser *docopt_engine.Parser, doc string, examples []*Usage_example) bool {
+	success := true
+	cache := New_usage_cache()
+	fmt.Fprintf(out, "1..%d\n", len(examples))
+	for i, e := range examples {
+		failures := e.Check(parser, doc, cache)
+		if len(failures) == 0 {
+			fmt.Fprintf(out, "ok %d - %s\n", i+1, e.Line)
+			continue
+		}
+		success = false
+		fmt.Fprintf(out, "not ok %d - %s\n", i+1, e.Line)
+		sort.Strings(failures)
+		for _, f := range failures {
+			fmt.Fprintf(out, "#   %s\n", f)
+		}
+	}
+	return success
+}
+
+// Shell_split splits words as the shell does for quoting: single quotes,
+// double quotes and backslash escape. No expansion is performed.
+func Shell_split(s string) ([]string, error) {
+	words := []string{}
+	var word strings.Builder
+	in_word := false
+	quote := rune(0)
+	escaped := false
+	for _, c := range s {
+		switch {
+		case escaped:
+			word.WriteRune(c)
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped = true
+			in_word = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				word.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			in_word = true
+		case c == ' ' || c == '\t':
+			if in_word {
+				words = append(words, word.String())
+				word.Reset()
+				in_word = false
+			}
+		default:
+			word.WriteRune(c)
+			in_word = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote %c", quote)
+	}
+	if escaped {
+		return nil, fmt.Errorf("trailing backslash")
+	}
+	if in_word {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
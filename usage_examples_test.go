@@ -0,0 +1,157 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// unit test for usage_examples.go
+//
+package main
+
+import (
+	"bytes"
+	"github.com/docopt/docopts/docopt_engine"
+	"reflect"
+	"testing"
+)
+
+func TestShell_split(t *testing.T) {
+	tables := []struct {
+		input  string
+		expect []string
+	}{
+		{"prog ship new foo", []string{"prog", "ship", "new", "foo"}},
+		{"  prog   'a b'  ", []string{"prog", "a b"}},
+		{`prog "it's" 'say "hi"'`, []string{"prog", "it's", `say "hi"`}},
+		{`prog a\ b ''`, []string{"prog", "a b", ""}},
+		{"", []string{}},
+	}
+
+	for _, table := range tables {
+		res, err := Shell_split(table.input)
+		if err != nil {
+			t.Errorf("Shell_split for '%s' error: %v", table.input, err)
+		}
+		if !reflect.DeepEqual(res, table.expect) {
+			t.Errorf("Shell_split for '%s'\ngot: %q\nwant: %q", table.input, res, table.expect)
+		}
+	}
+
+	for _, input := range []string{"prog 'a", `prog "a`, `prog a\`} {
+		if _, err := Shell_split(input); err == nil {
+			t.Errorf("Shell_split for '%s' expecting an error", input)
+		}
+	}
+}
+
+func TestParse_example(t *testing.T) {
+	e, err := Parse_example("prog ship new 'foo bar'  # => '<name>=[foo bar]' new=true")
+	if err != nil {
+		t.Fatalf("Parse_example error: %v", err)
+	}
+	if !reflect.DeepEqual(e.Argv, []string{"ship", "new", "foo bar"}) {
+		t.Errorf("Parse_example Argv got: %q", e.Argv)
+	}
+	expect := map[string]string{"<name>": "[foo bar]", "new": "true"}
+	if !reflect.DeepEqual(e.Expect, expect) {
+		t.Errorf("Parse_example Expect got: %v, want: %v", e.Expect, expect)
+	}
+
+	e, err = Parse_example("prog ship # => error")
+	if err != nil || !e.Expect_error {
+		t.Errorf("Parse_example error expected got: %+v, err: %v", e, err)
+	}
+	e, err = Parse_example("prog --help # => help")
+	if err != nil || !e.Expect_help {
+		t.Errorf("Parse_example help expected got: %+v, err: %v", e, err)
+	}
+
+	for _, input := range []string{"", "# => new=true", "prog # => new", "prog # => =true"} {
+		if _, err := Parse_example(input); err == nil {
+			t.Errorf("Parse_example for '%s' expecting an error", input)
+		}
+	}
+}
+
+func TestRun_examples(t *testing.T) {
+	// replace out (os.Stdout) by a buffer
+	bak := out
+	out = new(bytes.Buffer)
+	defer func() { out = bak }()
+
+	doc := naval_fate + `
+Examples:
+  $ naval_fate.py ship new foo bar   # => '<name>=[foo bar]' new=true
+  $ naval_fate.py ship Guardian move 1 2 --speed=20  # => --speed=20 <x>=1
+  Comment lines are ignored.
+  $ naval_fate.py mine set 1 2
+  $ naval_fate.py mine  # => error
+  $ naval_fate.py --help  # => help
+`
+	examples, err := Parse_examples(doc)
+	if err != nil {
+		t.Fatalf("Parse_examples error: %v", err)
+	}
+	if len(examples) != 5 {
+		t.Fatalf("Parse_examples got %d examples, want: 5", len(examples))
+	}
+
+	parser := &docopt_engine.Parser{HelpHandler: docopt_engine.NoHelpHandler}
+	if !Run_examples(parser, doc, examples) {
+		t.Errorf("Run_examples failed:\n%s", out.(*bytes.Buffer).String())
+	}
+	expect := "1..5\nok 1 - naval_fate.py ship new foo bar\n"
+	if res := out.(*bytes.Buffer).String(); res[:len(expect)] != expect {
+		t.Errorf("Run_examples\ngot: '%s'\nwant: '%s'", res, expect)
+	}
+	out.(*bytes.Buffer).Reset()
+
+	doc = naval_fate + `
+Examples:
+  $ naval_fate.py ship new foo  # => <name>=[bar] --speed=20 --nope=1
+  $ naval_fate.py ship  # => new=true
+  $ naval_fate.py ship new foo  # => error
+`
+	examples, _ = Parse_examples(doc)
+	if Run_examples(parser, doc, examples) {
+		t.Errorf("Run_examples expecting failures")
+	}
+	expect = `1..3
+not ok 1 - naval_fate.py ship new foo
+#   --nope: not found in parsed arguments
+#   --speed: got: 10, want: 20
+#   <name>: got: [foo], want: [bar]
+not ok 2 - naval_fate.py ship
+#   got: error, want: parsed arguments
+not ok 3 - naval_fate.py ship new foo
+#   got: parsed arguments, want: error
+`
+	if res := out.(*bytes.Buffer).String(); res != expect {
+		t.Errorf("Run_examples\ngot: '%s'\nwant: '%s'", res, expect)
+	}
+}
+
+func TestRun_examples_annotations(t *testing.T) {
+	// replace out (os.Stdout) by a buffer
+	bak := out
+	out = new(bytes.Buffer)
+	defer func() { out = bak }()
+
+	doc := `Usage: prog [options] [--when[=<w>]] <n>
+
+Options:
+  --[no-]color    Colorize [default: true]
+  --when[=<w>]    When [default-if-present: auto] [choices: auto|never]
+  <n>             Count [type: int]
+
+Examples:
+  $ prog 3  # => --color=true <n>=3
+  $ prog --no-color --when 3  # => --color=false --when=auto <n>=3
+  $ prog --when=always 3  # => error
+  $ prog three  # => error
+`
+	examples, err := Parse_examples(doc)
+	if err != nil {
+		t.Fatalf("Parse_examples error: %v", err)
+	}
+	parser := &docopt_engine.Parser{HelpHandler: docopt_engine.NoHelpHandler}
+	if !Run_examples(parser, doc, examples) {
+		t.Errorf("Run_examples failed:\n%s", out.(*bytes.Buffer).String())
+	}
+}
@@ -0,0 +1,314 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// usage_fmt.go implements the verb: docopts fmt
+//
+// The usage section and the options sections are rewritten in a canonical
+// form, all other text is kept verbatim. The result is refused if it would
+// change the parsed pattern.
+//
+package main
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var Usage_fmt string = `Output the usage message in a canonical format.
+
+Usage:
+  docopts fmt [--check] <msg>
+  docopts fmt --help
+
+Options:
+  --check  Don't output the formatted usage, exit 1 if <msg> is not already
+           formatted.
+  <msg>    The usage message in docopt format. If - is given, read the usage
+           message from standard input.
+
+The canonical format is:
+  - usage patterns one per line, indented by 2 spaces;
+  - option descriptions indented by 2 spaces, written: -s, --long=<arg>;
+  - option descriptions aligned, 2 spaces after the longest option;
+  - [default: x] at the end of the description.
+`
+
+func init() {
+	verbs["fmt"] = Verb_fmt
+}
+
+func Verb_fmt(argv []string) int {
+	arguments := Parse_verb_args(Usage_fmt, argv)
+	doc := Read_msg(arguments["<msg>"].(string))
+
+	formatted, err := Format_usage(doc)
+	if err != nil {
+		docopts_error("fmt: %v", err)
+	}
+
+	if !arguments["--check"].(bool) {
+		fmt.Fprintln(out, formatted)
+		return 0
+	}
+	if formatted != doc {
+		doc_lines := strings.Split(doc, "\n")
+		for i, line := range strings.Split(formatted, "\n") {
+			if i >= len(doc_lines) || doc_lines[i] != line {
+				fmt.Fprintf(os.Stderr, "docopts fmt: usage is not formatted, line %d:\n-%s\n+%s\n",
+					i+1, get_line(doc_lines, i), line)
+				break
+			}
+		}
+		return 1
+	}
+	return 0
+}
+
+func get_line(lines []string, i int) string {
+	if i < len(lines) {
+		return lines[i]
+	}
+	return ""
+}
+
+// Format_usage returns doc in canonical format. The formatted doc is parsed
+// again, an error is returned if the pattern or the options differ.
+func Format_usage(doc string) (string, error) {
+	before, err := Parse_annotated_usage(doc)
+	if err != nil {
+		return "", err
+	}
+
+	lines := strings.Split(doc, "\n")
+	result := []string{}
+	for i := 0; i < len(lines); {
+		end := section_end(lines, i)
+		switch {
+		case Match(`(?i)usage:`, lines[i]):
+			result = append(result, format_usage_section(lines[i:end], before.Prog)...)
+			i = end
+		case Match(`(?i)options:`, lines[i]):
+			result = append(result, format_options_section(lines[i:end])...)
+			i = end
+		default:
+			result = append(result, strings.TrimRight(lines[i], " \t"))
+			i++
+		}
+	}
+	formatted := strings.Join(result, "\n")
+
+	after, err := Parse_annotated_usage(formatted)
+	if err != nil {
+		return "", fmt.Errorf("formatted usage cannot be parsed: %v", err)
+	}
+	if !before.Same_parse(after) {
+		return "", fmt.Errorf("formatting would change the parsed usage, please report this usage")
+	}
+	return formatted, nil
+}
+
+// section_end returns the index after the last indented line following the
+// header at start, as Parse_section does.
+func section_end(lines []string, start int) int {
+	end := start + 1
+	for end < len(lines) && Match(`^[ \t]`, lines[end]) {
+		end++
+	}
+	return end
+}
+
+func format_usage_section(lines []string, prog string) []string {
+	header, _, first := string_partition(lines[0], ":")
+	result := []string{strings.TrimRight(header, " \t") + ":"}
+
+	continuation := strings.Repeat(" ", len(prog)+3)
+	for i, line := range append([]string{first}, lines[1:]...) {
+		words := strings.Fields(line)
+		if len(words) == 0 {
+			if i > 0 {
+				result = append(result, "")
+			}
+			continue
+		}
+		if words[0] == prog {
+			result = append(result, "  "+strings.Join(words, " "))
+		} else {
+			// pattern continued on the next line
+			result = append(result, continuation+strings.Join(words, " "))
+		}
+	}
+	return result
+}
+
+// an entry of an options section: the option (or argument) and the lines of
+// its description
+type options_entry struct {
+	name        string
+	description []string
+	// column of the description in the original text
+	column int
+}
+
+func format_options_section(lines []string) []string {
+	result := []string{strings.TrimRight(lines[0], " \t")}
+
+	// entries are the least indented lines, other lines are descriptions
+	indent := -1
+	for _, line := range lines[1:] {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed != "" && (indent < 0 || len(line)-len(trimmed) < indent) {
+			indent = len(line) - len(trimmed)
+		}
+	}
+
+	entries := []*options_entry{}
+	for _, line := range lines[1:] {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			if len(entries) > 0 {
+				last := entries[len(entries)-1]
+				last.description = append(last.description, "")
+			}
+			continue
+		}
+		if len(line)-len(strings.TrimLeft(line, " \t")) == indent || len(entries) == 0 {
+			name, _, description := string_partition(trimmed, "  ")
+			e := &options_entry{name: Canonical_option(name), column: -1}
+			if description = strings.TrimSpace(description); description != "" {
+				e.description = []string{description}
+				e.column = strings.Index(line, description)
+			}
+			entries = append(entries, e)
+		} else {
+			// extra indentation relative to the description is kept
+			last := entries[len(entries)-1]
+			column := len(line) - len(strings.TrimLeft(line, " \t"))
+			if last.column < 0 {
+				last.column = column
+			}
+			if column > last.column {
+				trimmed = strings.Repeat(" ", column-last.column) + trimmed
+			}
+			last.description = append(last.description, trimmed)
+		}
+	}
+
+	width := 0
+	for _, e := range entries {
+		e.description = move_default(e.description)
+		if len(e.name) > width {
+			width = len(e.name)
+		}
+	}
+
+	for _, e := range entries {
+		if len(e.description) == 0 {
+			result = append(result, "  "+e.name)
+			continue
+		}
+		for i, d := range e.description {
+			if d == "" {
+				result = append(result, "")
+			} else if i == 0 {
+				result = append(result, fmt.Sprintf("  %-*s  %s", width, e.name, d))
+			} else {
+				result = append(result, fmt.Sprintf("  %-*s  %s", width, "", d))
+			}
+		}
+	}
+	return result
+}
+
+// Canonical_option rewrites an option description head as: -s, --long=<arg>
+// Argument or text not starting with a dash is returned unchanged.
+func Canonical_option(name string) string {
+	if !strings.HasPrefix(name, "-") {
+		return name
+	}
+	o := Parse_option(name)
+	canonical := []string{}
+	if o.Short != "" {
+		canonical = append(canonical, o.Short)
+	}
+	if o.Long != "" {
+		canonical = append(canonical, o.Long)
+	}
+	s := strings.Join(canonical, ", ")
+	if o.Argcount > 0 {
+		if o.Long != "" {
+			s += "=" + o.Arg_name
+		} else {
+			s += " " + o.Arg_name
+		}
+	}
+	return s
+}
+
+// move_default moves [default: x] at the end of the last description line.
+func move_default(description []string) []string {
+	re_default := regexp.MustCompile(`(?i)\s*\[default: ([^\]]*)\]`)
+	default_value := ""
+	found := false
+	for i, d := range description {
+		if m := re_default.FindStringSubmatch(d); m != nil && !found {
+			default_value = m[1]
+			found = true
+			indent := d[:len(d)-len(strings.TrimLeft(d, " "))]
+			description[i] = strings.TrimSpace(re_default.ReplaceAllString(d, ""))
+			if description[i] != "" {
+				description[i] = indent + description[i]
+			}
+		}
+	}
+	if !found {
+		return description
+	}
+
+	// skip trailing empty lines and lines emptied by the removal
+	last := len(description) - 1
+	for last > 0 && description[last] == "" {
+		last--
+	}
+	if description[last] == "" {
+		description[last] = fmt.Sprintf("[default: %s]", default_value)
+	} else {
+		description[last] += fmt.Sprintf(" [default: %s]", default_value)
+	}
+
+	result := []string{}
+	for i, d := range description {
+		if d != "" || i > last {
+			result = append(result, d)
+		}
+	}
+	return result
+}
+
+// Same_parse compares the parsed patterns and options of two models, the
+// descriptions text is not compared.
+func (m *Usage_model) Same_parse(other *Usage_model) bool {
+	if m.Prog != other.Prog || !reflect.DeepEqual(m.Pattern, other.Pattern) {
+		return false
+	}
+	return reflect.DeepEqual(m.parsed_options(), other.parsed_options())
+}
+
+func (m *Usage_model) parsed_options() []Option_desc {
+	options := make([]Option_desc, len(m.Options))
+	for i, o := range m.Options {
+		options[i] = Option_desc{
+			Short:       o.Short,
+			Long:        o.Long,
+			Argcount:    o.Argcount,
+			Default:     o.Default,
+			Has_default: o.Has_default,
+		}
+	}
+	sort.Slice(options, func(i, j int) bool {
+		return options[i].Short+options[i].Long < options[j].Short+options[j].Long
+	})
+	return options
+}
@@ -0,0 +1,117 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// unit test for usage_fmt.go
+//
+package main
+
+import (
+	"testing"
+)
+
+func TestFormat_usage(t *testing.T) {
+	tables := []struct {
+		input  string
+		expect string
+	}{
+		{
+			naval_fate[:len(naval_fate)-1],
+			`Naval Fate.
+
+Usage:
+  naval_fate.py ship new <name>...
+  naval_fate.py ship <name> move <x> <y> [--speed=<kn>]
+  naval_fate.py ship shoot <x> <y>
+  naval_fate.py mine (set|remove) <x> <y> [--moored|--drifting]
+  naval_fate.py -h | --help
+  naval_fate.py --version
+
+Options:
+  -h, --help    Show this screen.
+  --version     Show version.
+  --speed=<kn>  Speed in knots. [default: 10]
+  --moored      Moored (anchored) mine.
+  --drifting    Drifting mine.`,
+		},
+		{
+			`My prog.   
+Usage: prog   [options]   <file>
+       prog --very-long-option
+            [--other]
+
+Options:
+    --output FILE, -o FILE    Output file.
+    -v --verbose   Verbose.
+    --count=<n>      [default: 3] Count of things,
+                     on two lines:
+                       indented.
+    <file>  The file.`,
+			`My prog.
+Usage:
+  prog [options] <file>
+  prog --very-long-option
+       [--other]
+
+Options:
+  -o, --output=FILE  Output file.
+  -v, --verbose      Verbose.
+  --count=<n>        Count of things,
+                     on two lines:
+                       indented. [default: 3]
+  <file>             The file.`,
+		},
+	}
+
+	for _, table := range tables {
+		res, err := Format_usage(table.input)
+		if err != nil {
+			t.Errorf("Format_usage error: %v", err)
+		}
+		if res != table.expect {
+			t.Errorf("Format_usage for '%s'\ngot: '%s'\nwant: '%s'", table.input, res, table.expect)
+		}
+		// formatting is idempotent
+		again, _ := Format_usage(res)
+		if again != res {
+			t.Errorf("Format_usage not idempotent\ngot: '%s'\nwant: '%s'", again, res)
+		}
+	}
+
+	// docopt-go takes all the text up to the last ] as default value, moving
+	// it would change the parsed default
+	_, err := Format_usage("Usage: prog [--speed=<kn>]\n\nOptions:\n  --speed=<kn>  [default: 10] in knots [km/h].")
+	if err == nil {
+		t.Errorf("Format_usage expecting an error when the parse result changes")
+	}
+	_, err = Format_usage("Usage: prog [cmd")
+	if err == nil {
+		t.Errorf("Format_usage expecting an error on invalid usage")
+	}
+}
+
+func TestCanonical_option(t *testing.T) {
+	tables := []struct {
+		input  string
+		expect string
+	}{
+		{"-h --help", "-h, --help"},
+		{"--help, -h", "-h, --help"},
+		{"--speed <kn>", "--speed=<kn>"},
+		{"-s <kn>, --speed=<kn>", "-s, --speed=<kn>"},
+		{"-o FILE", "-o FILE"},
+		{"<file>", "<file>"},
+	}
+
+	for _, table := range tables {
+		res := Canonical_option(table.input)
+		if res != table.expect {
+			t.Errorf("Canonical_option for '%s', got: %s, want: %s", table.input, res, table.expect)
+		}
+	}
+}
+
+func TestFormat_usage_extended_syntax(t *testing.T) {
+	res, err := Format_usage(extended_syntax)
+	if err != nil || res != extended_syntax {
+		t.Errorf("Format_usage for '%s'\ngot: '%s', err: %v", extended_syntax, res, err)
+	}
+}
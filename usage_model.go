@@ -0,0 +1,354 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// usage_model.go is the view of a docopt usage string used by the verbs.
+//
+// Verbs which need to inspect the usage (skeleton, ...) read it from the
+// pattern compiled by docopt_engine, the parser of argv: both can't disagree.
+// The options sections are read here too, to keep the argument names and the
+// descriptions docopt_engine drops.
+//
+package main
+
+import (
+	"github.com/docopt/docopts/docopt_engine"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+type Pattern_kind int
+
+const (
+	// branch
+	Pattern_required Pattern_kind = iota
+	Pattern_optional
+	Pattern_either
+	Pattern_one_or_more
+	Pattern_options_shortcut
+	// leaf
+	Pattern_option
+	Pattern_argument
+	Pattern_command
+)
+
+// A node of the usage pattern tree. Leaves have a Name which is the key found
+// in the parsed docopt.Opts: --long or -s for options, <arg> or ARG for
+// arguments, the word itself for commands.
+type Pattern struct {
+	Kind     Pattern_kind
+	Name     string
+	Children []*Pattern
+}
+
+func (p *Pattern) Is_leaf() bool {
+	return p.Kind >= Pattern_option
+}
+
+// An option described in an "Options:" section.
+type Option_desc struct {
+	Short       string
+	Long        string
+	Argcount    int
+	Arg_name    string
+	Default     string
+	Has_default bool
+	Description string
+}
+
+// Name is the key used by docopt for this option: the long name if any.
+func (o *Option_desc) Name() string {
+	if o.Long != "" {
+		return o.Long
+	}
+	return o.Short
+}
+
+type Usage_model struct {
+	// program name: the first word of the usage section
+	Prog string
+	// the "usage:" section, verbatim
+	Usage   string
+	Options []*Option_desc
+	// one Required child per usage line, wrapped in an Either if more than one
+	Pattern *Pattern
+	// leaf names which can be repeated: their value is a counter or an array
+	Repeated map[string]bool
+}
+
+// Parse_usage builds a Usage_model from a docopt usage string. The error is
+// docopt_engine's *LanguageError for a malformed usage.
+func Parse_usage(doc string) (*Usage_model, error) {
+	u, err := docopt_engine.Compile(doc)
+	if err != nil {
+		return nil, err
+	}
+	return New_usage_model(u), nil
+}
+
+// New_usage_model builds the Usage_model of the compiled usage u.
+func New_usage_model(u *docopt_engine.Usage) *Usage_model {
+	m := &Usage_model{
+		Usage:    Parse_section("usage:", u.Doc())[0],
+		Options:  Parse_options(u.Doc()),
+		Repeated: make(map[string]bool),
+	}
+	_, _, section := string_partition(m.Usage, ":")
+	m.Prog = strings.Fields(section)[0]
+
+	// options only found in the usage lines
+	for _, o := range u.Options() {
+		if m.Find_option(o.Name) == nil {
+			m.Options = append(m.Options, &Option_desc{Short: o.Short, Long: o.Long, Argcount: o.Argcount})
+		}
+	}
+
+	// the root is required, holding the either of the lines or the only line
+	m.Pattern = m.convert(u.Pattern().Children[0])
+	return m
+}
+
+var pattern_kinds = map[string]Pattern_kind{
+	"required":        Pattern_required,
+	"optional":        Pattern_optional,
+	"either":          Pattern_either,
+	"oneormore":       Pattern_one_or_more,
+	"optionsshortcut": Pattern_options_shortcut,
+	"option":          Pattern_option,
+	"argument":        Pattern_argument,
+	"command":         Pattern_command,
+}
+
+// convert copies the docopt_engine pattern, and records the repeated leaves:
+// docopt_engine gives them a counter or an array value.
+func (m *Usage_model) convert(n *docopt_engine.Node) *Pattern {
+	p := &Pattern{Kind: pattern_kinds[n.Type], Name: n.Name}
+	switch n.Value.(type) {
+	case int, []string:
+		m.Repeated[n.Name] = true
+	}
+	// the options brought by [options] are listed by Leaves()
+	if p.Kind != Pattern_options_shortcut {
+		for _, c := range n.Children {
+			p.Children = append(p.Children, m.convert(c))
+		}
+	}
+	return p
+}
+
+// Parse_section is docopt-go's section detection: a line containing name
+// followed by all the indented lines.
+func Parse_section(name, source string) []string {
+	p := regexp.MustCompile(`(?im)^([^\n]*` + name + `[^\n]*\n?(?:[ \t].*?(?:\n|$))*)`)
+	s := p.FindAllString(source, -1)
+	if s == nil {
+		s = []string{}
+	}
+	for i, v := range s {
+		s[i] = strings.TrimSpace(v)
+	}
+	return s
+}
+
+// Parse_options reads all option descriptions from all "options:" sections.
+func Parse_options(doc string) []*Option_desc {
+	options := []*Option_desc{}
+	p := regexp.MustCompile(`\n[ \t]*(-\S+?)`)
+	for _, s := range Parse_section("options:", doc) {
+		_, _, s = string_partition(s, ":")
+		split := p.Split("\n"+s, -1)[1:]
+		match := p.FindAllStringSubmatch("\n"+s, -1)
+		for i := range split {
+			description := match[i][1] + split[i]
+			if strings.HasPrefix(description, "-") {
+				options = append(options, Parse_option(description))
+			}
+		}
+	}
+	return options
+}
+
+// Parse_option parses one option description, as docopt-go's parseOption
+// but keeps the argument name and the description text.
+func Parse_option(option_description string) *Option_desc {
+	option_description = strings.TrimSpace(option_description)
+	options, _, description := string_partition(option_description, "  ")
+	options = strings.Replace(options, ",", " ", -1)
+	options = strings.Replace(options, "=", " ", -1)
+
+	o := &Option_desc{Description: strings.TrimSpace(description)}
+	re_default := regexp.MustCompile(`(?i)\[default: (.*)\]`)
+	for _, s := range strings.Fields(options) {
+		if strings.HasPrefix(s, "--") {
+			o.Long = s
+		} else if strings.HasPrefix(s, "-") {
+			o.Short = s
+		} else {
+			o.Argcount = 1
+			o.Arg_name = s
+		}
+	}
+	if o.Argcount > 0 {
+		matched := re_default.FindStringSubmatch(description)
+		if len(matched) > 0 {
+			o.Default = matched[1]
+			o.Has_default = true
+		}
+	}
+	return o
+}
+
+// Find_option returns the option described with the given short or long name.
+func (m *Usage_model) Find_option(name string) *Option_desc {
+	for _, o := range m.Options {
+		if (o.Long != "" && o.Long == name) || (o.Short != "" && o.Short == name) {
+			return o
+		}
+	}
+	return nil
+}
+
+// Leaves returns all keys docopt-go will output for this usage, including
+// options brought by the [options] shortcut, sorted as Sort_args_keys does.
+func (m *Usage_model) Leaves() []string {
+	seen := make(map[string]bool)
+	shortcut := false
+	var walk func(p *Pattern)
+	walk = func(p *Pattern) {
+		if p.Is_leaf() {
+			seen[p.Name] = true
+		} else if p.Kind == Pattern_options_shortcut {
+			shortcut = true
+		}
+		for _, c := range p.Children {
+			walk(c)
+		}
+	}
+	walk(m.Pattern)
+	if shortcut {
+		for _, o := range m.Options {
+			seen[o.Name()] = true
+		}
+	}
+
+	leaves := make([]string, 0, len(seen))
+	for k := range seen {
+		leaves = append(leaves, k)
+	}
+	sort.Strings(leaves)
+	return leaves
+}
+
+// remove_leaf removes the leaf name from the pattern and the options.
+func (m *Usage_model) remove_leaf(name string) {
+	var remove func(p *Pattern)
+	remove = func(p *Pattern) {
+		children := []*Pattern{}
+		for _, c := range p.Children {
+			if !c.Is_leaf() || c.Name != name {
+				remove(c)
+				children = append(children, c)
+			}
+		}
+		p.Children = children
+	}
+	remove(m.Pattern)
+	options := []*Option_desc{}
+	for _, o := range m.Options {
+		if o.Name() != name {
+			options = append(options, o)
+		}
+	}
+	m.Options = options
+	delete(m.Repeated, name)
+}
+
+// Leaf_kind returns the kind of the given key: option, argument or command.
+func (m *Usage_model) Leaf_kind(name string) Pattern_kind {
+	if strings.HasPrefix(name, "-") && name != "-" && name != "--" {
+		return Pattern_option
+	}
+	if Match(`^<.*>$`, name) || is_upper(name) || name == "-" || name == "--" {
+		return Pattern_argument
+	}
+	return Pattern_command
+}
+
+// Command_paths lists, for each usage line, the sequences of commands which
+// can be selected, most specific first. Lines without command are omitted.
+func (m *Usage_model) Command_paths() [][]string {
+	lines := []*Pattern{m.Pattern}
+	if m.Pattern.Kind == Pattern_either {
+		lines = m.Pattern.Children
+	}
+
+	paths := [][]string{}
+	seen := make(map[string]bool)
+	for _, line := range lines {
+		for _, path := range expand_commands(line) {
+			key := strings.Join(path, " ")
+			if len(path) == 0 || seen[key] {
+				continue
+			}
+			seen[key] = true
+			paths = append(paths, path)
+		}
+	}
+
+	sort.SliceStable(paths, func(i, j int) bool {
+		return len(paths[i]) > len(paths[j])
+	})
+	return paths
+}
+
+// expand_commands enumerates all command sequences a pattern can produce.
+func expand_commands(p *Pattern) [][]string {
+	switch p.Kind {
+	case Pattern_command:
+		return [][]string{{p.Name}}
+	case Pattern_either:
+		result := [][]string{}
+		for _, c := range p.Children {
+			result = append(result, expand_commands(c)...)
+		}
+		return result
+	case Pattern_required, Pattern_one_or_more, Pattern_optional:
+		result := [][]string{{}}
+		for _, c := range p.Children {
+			next := [][]string{}
+			for _, head := range result {
+				for _, tail := range expand_commands(c) {
+					path := append(append([]string{}, head...), tail...)
+					next = append(next, path)
+				}
+			}
+			result = next
+		}
+		if p.Kind == Pattern_optional {
+			result = append(result, []string{})
+		}
+		return result
+	}
+	return [][]string{{}}
+}
+
+func is_upper(s string) bool {
+	has_letter := false
+	for _, r := range s {
+		if unicode.IsLower(r) {
+			return false
+		}
+		if unicode.IsUpper(r) {
+			has_letter = true
+		}
+	}
+	return has_letter
+}
+
+func string_partition(s, sep string) (string, string, string) {
+	split := strings.SplitN(s, sep, 2)
+	if len(split) == 1 {
+		return s, "", ""
+	}
+	return split[0], sep, split[1]
+}
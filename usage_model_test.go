@@ -0,0 +1,170 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// unit test for usage_model.go
+//
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+var naval_fate = `Naval Fate.
+
+Usage:
+  naval_fate.py ship new <name>...
+  naval_fate.py ship <name> move <x> <y> [--speed=<kn>]
+  naval_fate.py ship shoot <x> <y>
+  naval_fate.py mine (set|remove) <x> <y> [--moored|--drifting]
+  naval_fate.py -h | --help
+  naval_fate.py --version
+
+Options:
+  -h --help     Show this screen.
+  --version     Show version.
+  --speed=<kn>  Speed in knots [default: 10].
+  --moored      Moored (anchored) mine.
+  --drifting    Drifting mine.
+`
+
+// the syntax extensions of docopts, rewritten for docopt
+var extended_syntax = `Usage:
+  prog [options] [--when[=<w>]] <file>
+
+Options:
+  -c, --[no-]color  Colorize. [default: true]
+  -w, --when[=<w>]  When. [default-if-present: auto]`
+
+func TestParse_usage(t *testing.T) {
+	m, err := Parse_usage(naval_fate)
+	if err != nil {
+		t.Fatalf("Parse_usage error: %v", err)
+	}
+	if m.Prog != "naval_fate.py" {
+		t.Errorf("Parse_usage Prog got: %s, want: naval_fate.py", m.Prog)
+	}
+	if len(m.Pattern.Children) != 6 {
+		t.Errorf("Parse_usage got %d usage lines, want: 6", len(m.Pattern.Children))
+	}
+
+	expect := []string{
+		"--drifting", "--help", "--moored", "--speed", "--version",
+		"<name>", "<x>", "<y>",
+		"mine", "move", "new", "remove", "set", "ship", "shoot",
+	}
+	if leaves := m.Leaves(); !reflect.DeepEqual(leaves, expect) {
+		t.Errorf("Leaves\ngot: %v\nwant: %v", leaves, expect)
+	}
+
+	repeated := map[string]bool{"<name>": true}
+	if !reflect.DeepEqual(m.Repeated, repeated) {
+		t.Errorf("Repeated\ngot: %v\nwant: %v", m.Repeated, repeated)
+	}
+
+	o := m.Find_option("--speed")
+	if o == nil || o.Argcount != 1 || o.Arg_name != "<kn>" || o.Default != "10" {
+		t.Errorf("Find_option --speed got: %+v", o)
+	}
+	o = m.Find_option("-h")
+	if o == nil || o.Name() != "--help" {
+		t.Errorf("Find_option -h got: %+v", o)
+	}
+
+	errors := []string{
+		"no usage here",
+		"Usage: prog\nusage: prog",
+		"Usage: prog [cmd",
+		"Usage: prog cmd)",
+	}
+	for _, doc := range errors {
+		if _, err := Parse_usage(doc); err == nil {
+			t.Errorf("Parse_usage for '%s' expecting an error", doc)
+		}
+	}
+}
+
+func TestParse_usage_options_shortcut(t *testing.T) {
+	doc := `Usage: prog [options] <file>
+
+Options:
+  -v, --verbose     Verbose.
+  -o FILE           Output file.
+  -c --count=N      Count [default: 3].
+`
+	m, err := Parse_usage(doc)
+	if err != nil {
+		t.Fatalf("Parse_usage error: %v", err)
+	}
+	expect := []string{"--count", "--verbose", "-o", "<file>"}
+	if leaves := m.Leaves(); !reflect.DeepEqual(leaves, expect) {
+		t.Errorf("Leaves\ngot: %v\nwant: %v", leaves, expect)
+	}
+	o := m.Find_option("-c")
+	if o == nil || !o.Has_default || o.Default != "3" || o.Arg_name != "N" {
+		t.Errorf("Find_option -c got: %+v", o)
+	}
+}
+
+func TestCommand_paths(t *testing.T) {
+	tables := []struct {
+		input  string
+		expect [][]string
+	}{
+		{
+			naval_fate,
+			[][]string{
+				{"ship", "new"},
+				{"ship", "move"},
+				{"ship", "shoot"},
+				{"mine", "set"},
+				{"mine", "remove"},
+			},
+		},
+		{
+			"Usage: prog [cmd] FILE...",
+			[][]string{{"cmd"}},
+		},
+		{
+			"Usage: prog remote add <url>\n  prog remote\n  prog -v",
+			[][]string{{"remote", "add"}, {"remote"}},
+		},
+		{
+			"Usage: prog <file>",
+			[][]string{},
+		},
+	}
+
+	for _, table := range tables {
+		m, err := Parse_usage(table.input)
+		if err != nil {
+			t.Fatalf("Parse_usage error: %v", err)
+		}
+		res := m.Command_paths()
+		if !reflect.DeepEqual(res, table.expect) {
+			t.Errorf("Command_paths for '%s'\ngot: %v\nwant: %v", table.input, res, table.expect)
+		}
+	}
+}
+
+func TestRepeated(t *testing.T) {
+	tables := []struct {
+		input  string
+		expect map[string]bool
+	}{
+		{"Usage: prog -v...", map[string]bool{"-v": true}},
+		{"Usage: prog (-h | --help)", map[string]bool{}},
+		{"Usage: prog <src> <src> <dst>", map[string]bool{"<src>": true}},
+		{"Usage: prog go go\n  prog go", map[string]bool{"go": true}},
+		{"Usage: prog [--tag=<t>]...", map[string]bool{"--tag": true}},
+	}
+
+	for _, table := range tables {
+		m, err := Parse_usage(table.input)
+		if err != nil {
+			t.Fatalf("Parse_usage error: %v", err)
+		}
+		if !reflect.DeepEqual(m.Repeated, table.expect) {
+			t.Errorf("Repeated for '%s'\ngot: %v\nwant: %v", table.input, m.Repeated, table.expect)
+		}
+	}
+}
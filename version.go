@@ -0,0 +1,119 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// version.go implements the verb: docopts version
+//
+// The build metadata and the capabilities of docopts are output in JSON, so
+// wrapper scripts can detect features instead of parsing --version text.
+//
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+var Usage_version string = `Output the version of docopts.
+
+Usage:
+  docopts version [--json]
+  docopts version --help
+
+Options:
+  --json  Output the version, commit, build date, Go version and the
+          capabilities of docopts as a JSON object.
+
+Capabilities are lists of names:
+  output_modes  globals (default), assoc (-A), prefix (-G), dispatch
+                (--dispatch), env (docopts exec).
+  verbs         docopts sub-commands.
+  annotations   [name: ...] annotations supported in option descriptions.
+  syntax        extensions of the usage language: negatable (--[no-]name),
+                optional-value (--name[=<arg>]), constraints (Constraints:
+                section).
+  flags         options of docopts's command line added since the
+                capabilities exist: --cache, --connect...
+`
+
+// Output modes of the parsed arguments.
+var Output_modes = []string{"globals", "assoc", "prefix", "dispatch", "env"}
+
+type Capabilities struct {
+	Output_modes []string `json:"output_modes"`
+	Verbs        []string `json:"verbs"`
+	Annotations  []string `json:"annotations"`
+	Syntax       []string `json:"syntax"`
+	Flags        []string `json:"flags"`
+}
+
+var syntax_names, flag_names []string
+
+// Register_syntax is called from an init() in the source file of each
+// extension of the usage language.
+func Register_syntax(name string) {
+	syntax_names = append(syntax_names, name)
+}
+
+// Register_flag is called from an init() in the source file implementing an
+// option of docopts's command line.
+func Register_flag(name string) {
+	flag_names = append(flag_names, name)
+}
+
+func sorted(names []string) []string {
+	s := append([]string{}, names...)
+	sort.Strings(s)
+	return s
+}
+
+type Version_info struct {
+	Version      string       `json:"version"`
+	Commit       string       `json:"commit"`
+	Build_date   string       `json:"build_date"`
+	Go_version   string       `json:"go_version"`
+	Capabilities Capabilities `json:"capabilities"`
+}
+
+func init() {
+	verbs["version"] = Verb_version
+}
+
+func Verb_version(argv []string) int {
+	arguments := Parse_verb_args(Usage_version, argv)
+	if !arguments["--json"].(bool) {
+		fmt.Fprintln(out, strings.TrimSpace(Docopts_Version))
+		return 0
+	}
+
+	data, err := json.MarshalIndent(Get_version_info(), "", "  ")
+	if err != nil {
+		docopts_error("version: %v", err)
+	}
+	fmt.Fprintln(out, string(data))
+	return 0
+}
+
+// Get_version_info returns the build metadata and the capabilities.
+func Get_version_info() *Version_info {
+	verb_names := []string{}
+	for name := range verbs {
+		verb_names = append(verb_names, name)
+	}
+	sort.Strings(verb_names)
+
+	return &Version_info{
+		Version:    Version,
+		Commit:     GitCommit,
+		Build_date: BuildDate,
+		Go_version: runtime.Version(),
+		Capabilities: Capabilities{
+			Output_modes: Output_modes,
+			Verbs:        verb_names,
+			Annotations:  Annotation_names(),
+			Syntax:       sorted(syntax_names),
+			Flags:        sorted(flag_names),
+		},
+	}
+}
@@ -0,0 +1,67 @@
+// vim: set ts=4 sw=4 sts=4 noet:
+//
+// unit test for version.go
+//
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestGet_version_info(t *testing.T) {
+	data, err := json.Marshal(Get_version_info())
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	info := make(map[string]interface{})
+	if err := json.Unmarshal(data, &info); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	for _, key := range []string{"version", "commit", "build_date", "go_version", "capabilities"} {
+		if _, found := info[key]; !found {
+			t.Errorf("Get_version_info: key %s not found in: %s", key, data)
+		}
+	}
+
+	capabilities, _ := info["capabilities"].(map[string]interface{})
+	for _, key := range []string{"output_modes", "verbs", "annotations", "syntax", "flags"} {
+		if _, ok := capabilities[key].([]interface{}); !ok {
+			t.Errorf("Get_version_info: capabilities.%s is not a list in: %s", key, data)
+		}
+	}
+	verb_names, _ := capabilities["verbs"].([]interface{})
+	found := map[string]bool{}
+	for _, v := range verb_names {
+		found[v.(string)] = true
+	}
+	for _, verb := range []string{"exec", "lib", "version"} {
+		if !found[verb] {
+			t.Errorf("Get_version_info: verb %s not found in: %v", verb, verb_names)
+		}
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	c := Get_version_info().Capabilities
+	for _, name := range []string{"negatable", "optional-value", "constraints"} {
+		if !string_set(c.Syntax)[name] {
+			t.Errorf("Capabilities: syntax %s not found in: %v", name, c.Syntax)
+		}
+	}
+	// the flags are options of docopts's usage
+	options := map[string]bool{}
+	for _, o := range Parse_options(Usage) {
+		options[o.Long] = true
+	}
+	for _, name := range c.Flags {
+		if !options[name] {
+			t.Errorf("Capabilities: flag %s is not an option of docopts", name)
+		}
+	}
+	for _, name := range []string{"--cache", "--cache-dir", "--connect", "--config", "--dispatch"} {
+		if !string_set(c.Flags)[name] {
+			t.Errorf("Capabilities: flag %s not found in: %v", name, c.Flags)
+		}
+	}
+}